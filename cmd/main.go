@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
 	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/client"
@@ -25,24 +26,50 @@ func main() {
 		log.Print("Error starting new relic agent")
 	}
 
-	mongoConfig := config.NewMongoConfig()
+	var planetRepository repository.PlanetRepositoryInterface
 
-	mongo := repository.NewSession(*mongoConfig)
+	switch config.NewRepositoryConfig().Type {
+	case "memory":
+		planetRepository = repository.NewMemory()
+	case "sql":
+		sqlRepository, err := repository.NewSqlSession(*config.NewSqlConfig())
+		if err != nil {
+			log.Fatalf("error starting sql repository: %s", err)
+		}
+		planetRepository = sqlRepository
+	default:
+		planetRepository = repository.NewSession(*config.NewMongoConfig())
+	}
 
 	newLogger := logger.NewLogger(config.NewLoggerConfig())
 
-	swapiClient := client.NewSwapiClient("https://swapi.dev/api/", newLogger)
+	swapiClient := newSwapiClient(config.NewSwapiConfig(), config.NewCacheConfig(), newLogger)
 
 	r := mux.NewRouter()
 
-	planetHandler := handler.NewPlanetHandler(mongo, swapiClient, newLogger)
+	planetHandler := handler.NewPlanetHandlerWithConfig(planetRepository, swapiClient, newLogger, config.NewTimeoutConfig(),
+		config.NewIdempotencyConfig(), config.NewBatchConfig())
+
+	syncer := handler.NewSyncer(planetRepository, swapiClient, newLogger, config.NewTimeoutConfig(), config.NewSyncConfig())
+
+	go syncer.Run(context.Background())
+
+	r.Use(handler.RequestId)
 
 	nrgorilla.InstrumentRoutes(r, app)
 
 	r.HandleFunc("/v1/planets", planetHandler.SavePlanet).Methods("POST")
 	r.HandleFunc("/v1/planets", planetHandler.GetPlanets).Methods("GET")
+	r.HandleFunc("/v1/planets", planetHandler.RemovePlanets).Methods("DELETE")
+	r.HandleFunc("/v1/planets:batch", planetHandler.SavePlanets).Methods("POST")
 	r.HandleFunc("/v1/planets/{planetId}", planetHandler.GetPlanetById).Methods("GET")
 	r.HandleFunc("/v1/planets/{planetId}", planetHandler.RemovePlanetById).Methods("DELETE")
+	r.HandleFunc("/v1/planets/{planetId}", planetHandler.UpdatePlanet).Methods("PUT")
+	r.HandleFunc("/v1/planets/{planetId}", planetHandler.PatchPlanet).Methods("PATCH")
+	r.HandleFunc("/v1/planets/{planetId}/films", planetHandler.GetPlanetFilms).Methods("GET")
+	r.HandleFunc("/v1/planets/{planetId}/residents", planetHandler.GetPlanetResidents).Methods("GET")
+	r.HandleFunc("/v1/admin/sync", syncer.TriggerSync).Methods("POST")
+	r.HandleFunc("/v1/admin/sync", syncer.GetSyncStatus).Methods("GET")
 
 	fmt.Printf("running server on %d", 8080)
 
@@ -52,3 +79,34 @@ func main() {
 		fmt.Printf("error to open port %s with error %s", "8080", err)
 	}
 }
+
+// newSwapiClient builds the SWAPI client for the configured mode, caching live lookups when the cache is enabled.
+func newSwapiClient(swapiConfig config.SwapiConfig, cacheConfig config.CacheConfig, appLogger logger.Interface) client.SwapiClientInterface {
+	var swapiClient client.SwapiClientInterface = client.NewSwapiClientWithConfig(swapiConfig.Endpoint, swapiConfig, appLogger)
+
+	if cacheConfig.Size > 0 {
+		swapiClient = client.NewCachedSwapiClient(swapiClient, cacheConfig, appLogger)
+	}
+
+	if swapiConfig.Mode == config.SwapiModeLive {
+		return swapiClient
+	}
+
+	snapshot, err := client.LoadSnapshot(swapiConfig.SnapshotPath)
+
+	if err != nil {
+		log.Fatalf("error loading swapi snapshot %s, generate it with go run ./cmd/snapshot -out %s: %s",
+			swapiConfig.SnapshotPath, swapiConfig.SnapshotPath, err)
+	}
+
+	if snapshot.FetchedAt.IsZero() {
+		log.Fatalf("swapi snapshot %s was not fetched from SWAPI, generate it with go run ./cmd/snapshot -out %s",
+			swapiConfig.SnapshotPath, swapiConfig.SnapshotPath)
+	}
+
+	if swapiConfig.Mode == config.SwapiModeOffline {
+		return client.NewOfflineSwapiClient(snapshot)
+	}
+
+	return client.NewFallbackSwapiClient(swapiClient, client.NewOfflineSwapiClient(snapshot), appLogger)
+}
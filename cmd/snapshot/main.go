@@ -0,0 +1,45 @@
+// Command snapshot refreshes the SWAPI snapshot used by the offline and fallback modes from the live API.
+//
+//	go run ./cmd/snapshot -out data/swapi.json
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/client"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/logger"
+	"log"
+)
+
+func main() {
+	swapiConfig := config.NewSwapiConfig()
+
+	endpoint := flag.String("endpoint", swapiConfig.Endpoint, "SWAPI endpoint to copy")
+	out := flag.String("out", swapiConfig.SnapshotPath, "file to write the snapshot to")
+	timeout := flag.Duration("timeout", 0, "give up after this long, zero to wait as long as needed")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	swapiClient := client.NewSwapiClientWithConfig(*endpoint, swapiConfig, logger.NewLogger(config.NewLoggerConfig()))
+
+	snapshot, err := client.BuildSnapshot(ctx, swapiClient, *endpoint)
+
+	if err != nil {
+		log.Fatalf("error copying swapi: %s", err)
+	}
+
+	if err = snapshot.Write(*out); err != nil {
+		log.Fatalf("error writing snapshot %s: %s", *out, err)
+	}
+
+	fmt.Printf("wrote %d planets, %d films and %d people to %s\n", len(snapshot.Planets), len(snapshot.Films), len(snapshot.People), *out)
+}
@@ -0,0 +1,22 @@
+package config
+
+// BatchConfig bounds the batch endpoint: how many planets one request may create and how many SWAPI lookups it
+// runs at once.
+type BatchConfig struct {
+	MaxSize     int
+	Concurrency int
+}
+
+func NewDefaultBatchConfig() BatchConfig {
+	return BatchConfig{
+		MaxSize:     100,
+		Concurrency: 4,
+	}
+}
+
+func NewBatchConfig() BatchConfig {
+	c := NewDefaultBatchConfig()
+	c.MaxSize = intFromEnv("BATCH_MAX_SIZE", c.MaxSize)
+	c.Concurrency = intFromEnv("BATCH_CONCURRENCY", c.Concurrency)
+	return c
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+// CacheConfig controls the cache of SWAPI searches. Found planets are kept for TTL and unknown names for
+// NegativeTTL; Size bounds the entries held in memory, zero disabling the cache, and a non empty Dir also
+// keeps them on disk across restarts.
+type CacheConfig struct {
+	Size        int
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	Dir         string
+}
+
+func NewDefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		Size:        256,
+		TTL:         24 * time.Hour,
+		NegativeTTL: time.Hour,
+	}
+}
+
+func NewCacheConfig() CacheConfig {
+	c := NewDefaultCacheConfig()
+	c.Size = intFromEnv("SWAPI_CACHE_SIZE", c.Size)
+	c.TTL = durationFromEnv("SWAPI_CACHE_TTL", c.TTL)
+	c.NegativeTTL = durationFromEnv("SWAPI_CACHE_NEGATIVE_TTL", c.NegativeTTL)
+	c.Dir = os.Getenv("SWAPI_CACHE_DIR")
+	return c
+}
@@ -0,0 +1,20 @@
+package config
+
+import "time"
+
+// IdempotencyConfig controls how long the response to a request carrying an Idempotency-Key is kept for retries.
+type IdempotencyConfig struct {
+	TTL time.Duration
+}
+
+func NewDefaultIdempotencyConfig() IdempotencyConfig {
+	return IdempotencyConfig{
+		TTL: 24 * time.Hour,
+	}
+}
+
+func NewIdempotencyConfig() IdempotencyConfig {
+	c := NewDefaultIdempotencyConfig()
+	c.TTL = durationFromEnv("IDEMPOTENCY_TTL", c.TTL)
+	return c
+}
@@ -0,0 +1,13 @@
+package config
+
+import "os"
+
+type RepositoryConfig struct {
+	Type string
+}
+
+func NewRepositoryConfig() RepositoryConfig {
+	return RepositoryConfig{
+		Type: os.Getenv("REPOSITORY_TYPE"),
+	}
+}
@@ -0,0 +1,17 @@
+package config
+
+import "os"
+
+// SqlConfig selects the database/sql driver, "sqlite3" or "postgres", and its data source name.
+// The sqlite3 driver needs a binary built with cgo.
+type SqlConfig struct {
+	Driver string
+	DSN    string
+}
+
+func NewSqlConfig() *SqlConfig {
+	return &SqlConfig{
+		Driver: os.Getenv("SQL_DRIVER"),
+		DSN:    os.Getenv("SQL_DSN"),
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// SwapiConfig controls where planets are looked up and how the SWAPI client times out, retries and stops calling
+// SWAPI when it keeps failing.
+type SwapiConfig struct {
+	Endpoint string
+
+	// Mode is live, offline to answer from the snapshot at SnapshotPath only, or fallback to use the snapshot
+	// when SWAPI fails. The snapshot is written by go run ./cmd/snapshot.
+	Mode         string
+	SnapshotPath string
+
+	Timeout     time.Duration
+	MaxRetries  int
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+
+	// BreakerThreshold consecutive failures open the circuit for BreakerCooldown; zero disables the breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// PageConcurrency caps how many catalogue pages are fetched at once.
+	PageConcurrency int
+}
+
+const (
+	SwapiModeLive     = "live"
+	SwapiModeOffline  = "offline"
+	SwapiModeFallback = "fallback"
+)
+
+func NewDefaultSwapiConfig() SwapiConfig {
+	return SwapiConfig{
+		Endpoint:         "https://swapi.dev/api/",
+		Mode:             SwapiModeLive,
+		SnapshotPath:     "data/swapi.json",
+		Timeout:          10 * time.Second,
+		MaxRetries:       3,
+		BackoffBase:      200 * time.Millisecond,
+		BackoffMax:       5 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+		PageConcurrency:  4,
+	}
+}
+
+func NewSwapiConfig() SwapiConfig {
+	c := NewDefaultSwapiConfig()
+	c.Endpoint = stringFromEnv("SWAPI_ENDPOINT", c.Endpoint)
+	c.Mode = stringFromEnv("SWAPI_MODE", c.Mode)
+	c.SnapshotPath = stringFromEnv("SWAPI_SNAPSHOT", c.SnapshotPath)
+	c.Timeout = durationFromEnv("SWAPI_TIMEOUT", c.Timeout)
+	c.MaxRetries = intFromEnv("SWAPI_MAX_RETRIES", c.MaxRetries)
+	c.BackoffBase = durationFromEnv("SWAPI_BACKOFF_BASE", c.BackoffBase)
+	c.BackoffMax = durationFromEnv("SWAPI_BACKOFF_MAX", c.BackoffMax)
+	c.BreakerThreshold = intFromEnv("SWAPI_BREAKER_THRESHOLD", c.BreakerThreshold)
+	c.BreakerCooldown = durationFromEnv("SWAPI_BREAKER_COOLDOWN", c.BreakerCooldown)
+	c.PageConcurrency = intFromEnv("SWAPI_PAGE_CONCURRENCY", c.PageConcurrency)
+	return c
+}
+
+func stringFromEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func intFromEnv(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
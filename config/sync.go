@@ -0,0 +1,24 @@
+package config
+
+import "time"
+
+// SyncConfig controls the background refresh of the SWAPI data stored on planets. The whole collection is synced
+// every Interval, zero leaving only manual syncs, reading BatchSize planets at a time.
+type SyncConfig struct {
+	Interval  time.Duration
+	BatchSize int
+}
+
+func NewDefaultSyncConfig() SyncConfig {
+	return SyncConfig{
+		Interval:  24 * time.Hour,
+		BatchSize: 50,
+	}
+}
+
+func NewSyncConfig() SyncConfig {
+	c := NewDefaultSyncConfig()
+	c.Interval = durationFromEnv("SYNC_INTERVAL", c.Interval)
+	c.BatchSize = intFromEnv("SYNC_BATCH_SIZE", c.BatchSize)
+	return c
+}
@@ -0,0 +1,27 @@
+package config
+
+import "time"
+
+// TimeoutConfig holds the deadlines applied by the handlers to repository reads, repository writes
+// and SWAPI lookups, on top of the incoming request context. Zero means no deadline.
+type TimeoutConfig struct {
+	Read  time.Duration
+	Write time.Duration
+	Swapi time.Duration
+}
+
+func NewDefaultTimeoutConfig() TimeoutConfig {
+	return TimeoutConfig{
+		Read:  5 * time.Second,
+		Write: 5 * time.Second,
+		Swapi: 30 * time.Second,
+	}
+}
+
+func NewTimeoutConfig() TimeoutConfig {
+	c := NewDefaultTimeoutConfig()
+	c.Read = durationFromEnv("READ_TIMEOUT", c.Read)
+	c.Write = durationFromEnv("WRITE_TIMEOUT", c.Write)
+	c.Swapi = durationFromEnv("SWAPI_LOOKUP_TIMEOUT", c.Swapi)
+	return c
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// getFilms resolves urls with client.GetFilm, running at most concurrency lookups at once. The films are returned
+// in the order of urls, without repetitions nor the films client does not know; the first failure is returned.
+func getFilms(ctx context.Context, client SwapiClientInterface, urls []string, concurrency int) ([]SwapiFilm, error) {
+	urls = uniqueUrls(urls)
+	found := make([]*SwapiFilm, len(urls))
+
+	err := getEach(ctx, urls, concurrency, func(ctx context.Context, i int) (err error) {
+		found[i], err = client.GetFilm(ctx, urls[i])
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	films := make([]SwapiFilm, 0, len(found))
+
+	for _, film := range found {
+		if film != nil {
+			films = append(films, *film)
+		}
+	}
+
+	return films, nil
+}
+
+// getPeople resolves urls with client.GetPerson the way getFilms resolves films.
+func getPeople(ctx context.Context, client SwapiClientInterface, urls []string, concurrency int) ([]SwapiPerson, error) {
+	urls = uniqueUrls(urls)
+	found := make([]*SwapiPerson, len(urls))
+
+	err := getEach(ctx, urls, concurrency, func(ctx context.Context, i int) (err error) {
+		found[i], err = client.GetPerson(ctx, urls[i])
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	people := make([]SwapiPerson, 0, len(found))
+
+	for _, person := range found {
+		if person != nil {
+			people = append(people, *person)
+		}
+	}
+
+	return people, nil
+}
+
+func uniqueUrls(urls []string) []string {
+	unique := make([]string, 0, len(urls))
+	seen := make(map[string]bool, len(urls))
+
+	for _, url := range urls {
+		if !seen[url] {
+			seen[url] = true
+			unique = append(unique, url)
+		}
+	}
+
+	return unique
+}
+
+// getEach calls get for every index of urls, at most concurrency at once, and cancels the calls left on the
+// first failure.
+func getEach(ctx context.Context, urls []string, concurrency int, get func(ctx context.Context, i int) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, len(urls))
+	slots := make(chan struct{}, concurrency)
+
+	var wait sync.WaitGroup
+
+	for i := range urls {
+		wait.Add(1)
+
+		go func(i int) {
+			defer wait.Done()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+
+			if errs[i] = get(ctx, i); errs[i] != nil {
+				cancel()
+			}
+		}(i)
+	}
+
+	wait.Wait()
+
+	return firstError(errs)
+}
+
+// firstError returns the first error that is not a consequence of another lookup failing.
+func firstError(errs []error) error {
+	var canceled error
+
+	for _, err := range errs {
+		if errors.Is(err, context.Canceled) {
+			if canceled == nil {
+				canceled = err
+			}
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return canceled
+}
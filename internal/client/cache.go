@@ -0,0 +1,249 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/logger"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Revalidator is implemented by SWAPI clients able to tell whether a cached search is still current.
+type Revalidator interface {
+	RevalidatePlanetByName(ctx context.Context, name string, validators Validators) (*SwapiPlanet, error)
+}
+
+// CacheStats counts how cached searches were answered since the client was created.
+type CacheStats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Revalidations uint64 `json:"revalidations"`
+}
+
+// CachedSwapiClient caches the planet searches of another SWAPI client, including the names SWAPI does not know,
+// and the films and people it resolves. Expired searches are revalidated with a conditional request when the client
+// supports it, and fetched again otherwise. Listings are not cached.
+type CachedSwapiClient struct {
+	client SwapiClientInterface
+	store  CacheStore
+	config config.CacheConfig
+	log    logger.Interface
+	stats  CacheStats
+}
+
+func NewCachedSwapiClient(client SwapiClientInterface, config config.CacheConfig, log logger.Interface) *CachedSwapiClient {
+	var disk CacheStore
+	if config.Dir != "" {
+		disk = NewDiskStore(config.Dir, log)
+	}
+
+	return NewCachedSwapiClientWithStore(client, NewLruStore(config.Size, disk), config, log)
+}
+
+func NewCachedSwapiClientWithStore(client SwapiClientInterface, store CacheStore, config config.CacheConfig,
+	log logger.Interface) *CachedSwapiClient {
+
+	c := new(CachedSwapiClient)
+	c.client = client
+	c.store = store
+	c.config = config
+	c.log = log
+	return c
+}
+
+func (c *CachedSwapiClient) GetPlanetByName(ctx context.Context, name string) (*SwapiPlanet, error) {
+	key := "planets?search=" + strings.ToLower(name)
+
+	entry, cached := c.store.Get(key)
+
+	if cached && c.fresh(entry) {
+		c.count(&c.stats.Hits, "hit", name)
+		return entry.Planets, nil
+	}
+
+	revalidator, canRevalidate := c.client.(Revalidator)
+
+	var planets *SwapiPlanet
+	var err error
+
+	if cached && canRevalidate && entry.Planets != nil && entry.Validators != (Validators{}) {
+		planets, err = revalidator.RevalidatePlanetByName(ctx, name, entry.Validators)
+
+		if errors.Is(err, ErrNotModified) {
+			entry.StoredAt = time.Now()
+			c.store.Set(key, entry)
+			c.count(&c.stats.Revalidations, "revalidated", name)
+			return entry.Planets, nil
+		}
+	} else {
+		planets, err = c.client.GetPlanetByName(ctx, name)
+	}
+
+	c.count(&c.stats.Misses, "miss", name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entry = CacheEntry{Planets: planets, StoredAt: time.Now()}
+	if planets != nil {
+		entry.Validators = planets.Validators
+	}
+
+	c.store.Set(key, entry)
+
+	return planets, nil
+}
+
+func (c *CachedSwapiClient) ListPlanets(ctx context.Context, search string) *PlanetIterator {
+	return c.client.ListPlanets(ctx, search)
+}
+
+func (c *CachedSwapiClient) GetFilm(ctx context.Context, url string) (*SwapiFilm, error) {
+	films, err := c.GetFilms(ctx, []string{url})
+
+	if err != nil || len(films) == 0 {
+		return nil, err
+	}
+
+	return &films[0], nil
+}
+
+// GetFilms answers the films cached and fresh, and asks the client for the others in a single batch.
+func (c *CachedSwapiClient) GetFilms(ctx context.Context, urls []string) ([]SwapiFilm, error) {
+	found := make(map[string]SwapiFilm, len(urls))
+	missing := make([]string, 0)
+
+	for _, url := range urls {
+		key := resourceKey(url)
+
+		if entry, cached := c.store.Get(key); cached && entry.Film != nil && c.fresh(entry) {
+			found[key] = *entry.Film
+			c.count(&c.stats.Hits, "hit", key)
+			continue
+		}
+
+		if _, ok := found[key]; !ok {
+			missing = append(missing, url)
+		}
+	}
+
+	if len(missing) > 0 {
+		fetched, err := c.client.GetFilms(ctx, missing)
+
+		c.count(&c.stats.Misses, "miss", strings.Join(missing, " "))
+
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range fetched {
+			key := resourceKey(fetched[i].Url)
+			found[key] = fetched[i]
+			c.store.Set(key, CacheEntry{Film: &fetched[i], StoredAt: time.Now()})
+		}
+	}
+
+	films := make([]SwapiFilm, 0, len(urls))
+	added := make(map[string]bool, len(urls))
+
+	for _, url := range urls {
+		key := resourceKey(url)
+
+		if film, ok := found[key]; ok && !added[key] {
+			added[key] = true
+			films = append(films, film)
+		}
+	}
+
+	return films, nil
+}
+
+func (c *CachedSwapiClient) GetPerson(ctx context.Context, url string) (*SwapiPerson, error) {
+	people, err := c.GetPeople(ctx, []string{url})
+
+	if err != nil || len(people) == 0 {
+		return nil, err
+	}
+
+	return &people[0], nil
+}
+
+// GetPeople answers the people cached and fresh, and asks the client for the others in a single batch.
+func (c *CachedSwapiClient) GetPeople(ctx context.Context, urls []string) ([]SwapiPerson, error) {
+	found := make(map[string]SwapiPerson, len(urls))
+	missing := make([]string, 0)
+
+	for _, url := range urls {
+		key := resourceKey(url)
+
+		if entry, cached := c.store.Get(key); cached && entry.Person != nil && c.fresh(entry) {
+			found[key] = *entry.Person
+			c.count(&c.stats.Hits, "hit", key)
+			continue
+		}
+
+		if _, ok := found[key]; !ok {
+			missing = append(missing, url)
+		}
+	}
+
+	if len(missing) > 0 {
+		fetched, err := c.client.GetPeople(ctx, missing)
+
+		c.count(&c.stats.Misses, "miss", strings.Join(missing, " "))
+
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range fetched {
+			key := resourceKey(fetched[i].Url)
+			found[key] = fetched[i]
+			c.store.Set(key, CacheEntry{Person: &fetched[i], StoredAt: time.Now()})
+		}
+	}
+
+	people := make([]SwapiPerson, 0, len(urls))
+	added := make(map[string]bool, len(urls))
+
+	for _, url := range urls {
+		key := resourceKey(url)
+
+		if person, ok := found[key]; ok && !added[key] {
+			added[key] = true
+			people = append(people, person)
+		}
+	}
+
+	return people, nil
+}
+
+// Stats returns the cache counters.
+func (c *CachedSwapiClient) Stats() CacheStats {
+	return CacheStats{
+		Hits:          atomic.LoadUint64(&c.stats.Hits),
+		Misses:        atomic.LoadUint64(&c.stats.Misses),
+		Revalidations: atomic.LoadUint64(&c.stats.Revalidations),
+	}
+}
+
+func (c *CachedSwapiClient) fresh(entry CacheEntry) bool {
+	ttl := c.config.TTL
+	if entry.Planets == nil && entry.Film == nil && entry.Person == nil {
+		ttl = c.config.NegativeTTL
+	}
+	return time.Now().Sub(entry.StoredAt) < ttl
+}
+
+func (c *CachedSwapiClient) count(counter *uint64, outcome string, name string) {
+	atomic.AddUint64(counter, 1)
+
+	stats := c.Stats()
+
+	c.log.LogWithFields(nil, "debug", map[string]interface{}{
+		"cache": outcome, "name": name, "hits": stats.Hits, "misses": stats.Misses, "revalidations": stats.Revalidations,
+	}, "swapi cache lookup")
+}
@@ -0,0 +1,188 @@
+package client
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/logger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CacheEntry is either a cached SWAPI search, where a nil Planets records that SWAPI knows no planet with that
+// name, a cached Film or a cached Person.
+type CacheEntry struct {
+	Planets    *SwapiPlanet `json:"planets"`
+	Film       *SwapiFilm   `json:"film,omitempty"`
+	Person     *SwapiPerson `json:"person,omitempty"`
+	Validators Validators   `json:"validators"`
+	StoredAt   time.Time    `json:"storedAt"`
+}
+
+type CacheStore interface {
+	Get(key string) (CacheEntry, bool)
+	Set(key string, entry CacheEntry)
+}
+
+// LruStore keeps the most recently used entries in memory, evicting the least recently used one past its size.
+// Entries missing in memory are looked up in the backing store, when there is one, and every entry set is
+// written through to it.
+type LruStore struct {
+	mutex   sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	backing CacheStore
+}
+
+type lruItem struct {
+	key   string
+	entry CacheEntry
+}
+
+func NewLruStore(size int, backing CacheStore) *LruStore {
+	s := new(LruStore)
+	s.size = size
+	s.order = list.New()
+	s.entries = make(map[string]*list.Element)
+	s.backing = backing
+	return s
+}
+
+func (s *LruStore) Get(key string) (CacheEntry, bool) {
+	s.mutex.Lock()
+
+	if element, ok := s.entries[key]; ok {
+		s.order.MoveToFront(element)
+		entry := element.Value.(*lruItem).entry
+		s.mutex.Unlock()
+		return entry, true
+	}
+
+	s.mutex.Unlock()
+
+	if s.backing == nil {
+		return CacheEntry{}, false
+	}
+
+	entry, ok := s.backing.Get(key)
+
+	if ok {
+		s.remember(key, entry)
+	}
+
+	return entry, ok
+}
+
+func (s *LruStore) Set(key string, entry CacheEntry) {
+	s.remember(key, entry)
+
+	if s.backing != nil {
+		s.backing.Set(key, entry)
+	}
+}
+
+func (s *LruStore) remember(key string, entry CacheEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		element.Value.(*lruItem).entry = entry
+		s.order.MoveToFront(element)
+		return
+	}
+
+	s.entries[key] = s.order.PushFront(&lruItem{key: key, entry: entry})
+
+	for s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*lruItem).key)
+	}
+}
+
+// DiskStore keeps each entry as a JSON file in a directory. Failures are logged and treated as misses,
+// so a broken disk only costs extra SWAPI calls.
+type DiskStore struct {
+	dir string
+	log logger.Interface
+}
+
+func NewDiskStore(dir string, log logger.Interface) *DiskStore {
+	s := new(DiskStore)
+	s.dir = dir
+	s.log = log
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.LogWithFields(nil, "error", map[string]interface{}{"dir": dir}, "error creating swapi cache dir: "+err.Error())
+	}
+
+	return s
+}
+
+func (s *DiskStore) Get(key string) (CacheEntry, bool) {
+	var entry CacheEntry
+
+	content, err := ioutil.ReadFile(s.path(key))
+
+	if os.IsNotExist(err) {
+		return entry, false
+	}
+
+	if err == nil {
+		err = json.Unmarshal(content, &entry)
+	}
+
+	if err != nil {
+		s.log.LogWithFields(nil, "warn", map[string]interface{}{"key": key}, "error reading swapi cache entry: "+err.Error())
+		return entry, false
+	}
+
+	return entry, true
+}
+
+func (s *DiskStore) Set(key string, entry CacheEntry) {
+	content, err := json.Marshal(entry)
+
+	if err == nil {
+		err = writeFileAtomically(s.path(key), content)
+	}
+
+	if err != nil {
+		s.log.LogWithFields(nil, "warn", map[string]interface{}{"key": key}, "error writing swapi cache entry: "+err.Error())
+	}
+}
+
+func (s *DiskStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// writeFileAtomically writes content next to path and renames it over path, so readers never see half a file.
+func writeFileAtomically(path string, content []byte) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), ".tmp-*")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(content)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+
+	if err != nil {
+		_ = os.Remove(file.Name())
+	}
+
+	return err
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("swapi circuit breaker is open")
+
+// CircuitOpenError wraps ErrCircuitOpen with how long the breaker keeps rejecting calls.
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return ErrCircuitOpen.Error()
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// circuitBreaker opens after threshold consecutive failures and rejects calls until cooldown has passed,
+// then lets a single probe through: a success closes it again, a failure keeps it open for another cooldown.
+type circuitBreaker struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	b := new(circuitBreaker)
+	b.threshold = threshold
+	b.cooldown = cooldown
+	return b
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+
+	b.probing = true
+
+	return true
+}
+
+// release ends a call without judging SWAPI health, freeing the probe slot when half-open.
+func (b *circuitBreaker) release() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.probing = false
+}
+
+func (b *circuitBreaker) record(success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.probing = false
+
+	if success {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
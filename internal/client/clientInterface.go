@@ -1,7 +1,20 @@
 package client
 
+import "context"
+
 type SwapiPlanet struct {
-	Results [] Results `json:"results"`
+	Count    int       `json:"count"`
+	Next     string    `json:"next"`
+	Previous string    `json:"previous"`
+	Results  [] Results `json:"results"`
+
+	Validators Validators `json:"-"`
+}
+
+// Validators identify a SWAPI answer, so it can be revalidated with a conditional request.
+type Validators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
 }
 
 type Results struct {
@@ -18,6 +31,31 @@ type Results struct {
 	Films          []string `json:"films"`
 }
 
+type SwapiFilm struct {
+	Title       string `json:"title"`
+	EpisodeId   int    `json:"episode_id"`
+	Director    string `json:"director"`
+	Producer    string `json:"producer"`
+	ReleaseDate string `json:"release_date"`
+	Url         string `json:"url"`
+}
+
+type SwapiPerson struct {
+	Name      string   `json:"name"`
+	Height    string   `json:"height"`
+	Mass      string   `json:"mass"`
+	BirthYear string   `json:"birth_year"`
+	Gender    string   `json:"gender"`
+	Homeworld string   `json:"homeworld"`
+	Species   []string `json:"species"`
+	Url       string   `json:"url"`
+}
+
 type SwapiClientInterface interface {
-	GetPlanetByName(name string) (*SwapiPlanet, error)
+	GetPlanetByName(ctx context.Context, name string) (*SwapiPlanet, error)
+	ListPlanets(ctx context.Context, search string) *PlanetIterator
+	GetFilm(ctx context.Context, url string) (*SwapiFilm, error)
+	GetFilms(ctx context.Context, urls []string) ([]SwapiFilm, error)
+	GetPerson(ctx context.Context, url string) (*SwapiPerson, error)
+	GetPeople(ctx context.Context, urls []string) ([]SwapiPerson, error)
 }
\ No newline at end of file
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/logger"
+)
+
+// FallbackSwapiClient asks the live client first and, when it fails, answers from the offline one instead.
+// Requests whose context ended are not retried offline, since nobody waits for their answer anymore.
+type FallbackSwapiClient struct {
+	live    SwapiClientInterface
+	offline SwapiClientInterface
+	log     logger.Interface
+}
+
+func NewFallbackSwapiClient(live SwapiClientInterface, offline SwapiClientInterface, log logger.Interface) *FallbackSwapiClient {
+	f := new(FallbackSwapiClient)
+	f.live = live
+	f.offline = offline
+	f.log = log
+	return f
+}
+
+func (f *FallbackSwapiClient) GetPlanetByName(ctx context.Context, name string) (*SwapiPlanet, error) {
+	planets, err := f.live.GetPlanetByName(ctx, name)
+
+	if f.shouldFallBack(ctx, err) {
+		return f.offline.GetPlanetByName(ctx, name)
+	}
+
+	return planets, err
+}
+
+// ListPlanets falls back to the offline planets only when the live listing fails before yielding any planet,
+// so callers never see a planet twice.
+func (f *FallbackSwapiClient) ListPlanets(ctx context.Context, search string) *PlanetIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	pages := make(chan planetPage)
+	it := newPlanetIterator(pages, cancel)
+
+	go func() {
+		defer close(pages)
+
+		source := f.live.ListPlanets(ctx, search)
+		yielded := false
+
+		for {
+			for source.Next() {
+				yielded = true
+
+				select {
+				case pages <- planetPage{planets: SwapiPlanet{Results: []Results{source.Planet()}}}:
+				case <-it.done:
+					source.Close()
+					return
+				}
+			}
+
+			source.Close()
+			err := source.Err()
+
+			if yielded || !f.shouldFallBack(ctx, err) {
+				if err != nil {
+					select {
+					case pages <- planetPage{err: err}:
+					case <-it.done:
+					}
+				}
+				return
+			}
+
+			source = f.offline.ListPlanets(ctx, search)
+			yielded = true
+		}
+	}()
+
+	return it
+}
+
+func (f *FallbackSwapiClient) GetFilm(ctx context.Context, url string) (*SwapiFilm, error) {
+	film, err := f.live.GetFilm(ctx, url)
+
+	if f.shouldFallBack(ctx, err) {
+		return f.offline.GetFilm(ctx, url)
+	}
+
+	return film, err
+}
+
+func (f *FallbackSwapiClient) GetFilms(ctx context.Context, urls []string) ([]SwapiFilm, error) {
+	films, err := f.live.GetFilms(ctx, urls)
+
+	if f.shouldFallBack(ctx, err) {
+		return f.offline.GetFilms(ctx, urls)
+	}
+
+	return films, err
+}
+
+func (f *FallbackSwapiClient) GetPerson(ctx context.Context, url string) (*SwapiPerson, error) {
+	person, err := f.live.GetPerson(ctx, url)
+
+	if f.shouldFallBack(ctx, err) {
+		return f.offline.GetPerson(ctx, url)
+	}
+
+	return person, err
+}
+
+func (f *FallbackSwapiClient) GetPeople(ctx context.Context, urls []string) ([]SwapiPerson, error) {
+	people, err := f.live.GetPeople(ctx, urls)
+
+	if f.shouldFallBack(ctx, err) {
+		return f.offline.GetPeople(ctx, urls)
+	}
+
+	return people, err
+}
+
+func (f *FallbackSwapiClient) shouldFallBack(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	f.log.LogWithFields(nil, "warn", map[string]interface{}{"err": err.Error()}, "swapi unavailable, answering from the offline snapshot")
+
+	return true
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+// planetPage is one page of planets fetched from SWAPI, or the error that stopped the listing.
+type planetPage struct {
+	planets SwapiPlanet
+	err     error
+}
+
+// PlanetIterator streams planets page by page, in SWAPI order. Callers must Close it when they stop early.
+//
+//	it := client.ListPlanets(ctx, "")
+//	defer it.Close()
+//	for it.Next() {
+//		planet := it.Planet()
+//	}
+//	err := it.Err()
+type PlanetIterator struct {
+	pages   <-chan planetPage
+	cancel  context.CancelFunc
+	done    chan struct{}
+	closing sync.Once
+	current []Results
+	planet  Results
+	err     error
+
+	// received counts the pages read so far; validators are those of the first one.
+	received   int
+	validators Validators
+}
+
+// NewPlanetIterator returns an iterator over planets already in memory.
+func NewPlanetIterator(planets []Results) *PlanetIterator {
+	pages := make(chan planetPage, 1)
+	pages <- planetPage{planets: SwapiPlanet{Count: len(planets), Results: planets}}
+	close(pages)
+
+	return newPlanetIterator(pages, func() {})
+}
+
+func newPlanetIterator(pages <-chan planetPage, cancel context.CancelFunc) *PlanetIterator {
+	return &PlanetIterator{pages: pages, cancel: cancel, done: make(chan struct{})}
+}
+
+// Next advances to the next planet, waiting for its page when needed. It returns false when the planets are
+// exhausted or a page could not be fetched.
+func (it *PlanetIterator) Next() bool {
+	for len(it.current) == 0 {
+		if it.err != nil {
+			return false
+		}
+
+		page, ok := <-it.pages
+
+		if !ok {
+			return false
+		}
+
+		if page.err != nil {
+			it.err = page.err
+			it.Close()
+			return false
+		}
+
+		it.received++
+		if it.received == 1 {
+			it.validators = page.planets.Validators
+		}
+
+		it.current = page.planets.Results
+	}
+
+	it.planet = it.current[0]
+	it.current = it.current[1:]
+
+	return true
+}
+
+// Planet returns the planet Next moved to.
+func (it *PlanetIterator) Planet() Results {
+	return it.planet
+}
+
+// Err returns the error that ended the iteration, if any.
+func (it *PlanetIterator) Err() error {
+	return it.err
+}
+
+// Close stops fetching the pages not read yet.
+func (it *PlanetIterator) Close() {
+	it.closing.Do(func() {
+		close(it.done)
+		it.cancel()
+	})
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrPlanetNotFound  = errors.New("no swapi planet matches the name")
+	ErrAmbiguousPlanet = errors.New("several swapi planets match the name")
+)
+
+// MatchError is returned by Match when no single SWAPI planet is named exactly as requested.
+// Candidates lists the names the search returned, so callers can offer them as alternatives.
+type MatchError struct {
+	Name       string
+	Candidates []string
+	err        error
+}
+
+func (e *MatchError) Error() string {
+	return e.err.Error() + ": " + e.Name
+}
+
+func (e *MatchError) Unwrap() error {
+	return e.err
+}
+
+// Match picks the search result whose name equals name ignoring case. SWAPI searches by substring, so
+// the results may hold other planets; Match fails with ErrPlanetNotFound when none is named name and with
+// ErrAmbiguousPlanet when more than one is.
+func (s *SwapiPlanet) Match(name string) (*Results, error) {
+	var candidates []string
+	var matches []int
+
+	if s != nil {
+		for i, result := range s.Results {
+			candidates = append(candidates, result.Name)
+
+			if strings.EqualFold(result.Name, name) {
+				matches = append(matches, i)
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 1:
+		return &s.Results[matches[0]], nil
+	case 0:
+		return nil, &MatchError{Name: name, Candidates: candidates, err: ErrPlanetNotFound}
+	default:
+		exact := make([]string, 0, len(matches))
+		for _, i := range matches {
+			exact = append(exact, s.Results[i].Name)
+		}
+		return nil, &MatchError{Name: name, Candidates: exact, err: ErrAmbiguousPlanet}
+	}
+}
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Snapshot is a copy of the SWAPI planets, with the films and people they link to, taken at FetchedAt from Source.
+type Snapshot struct {
+	Source    string        `json:"source"`
+	FetchedAt time.Time     `json:"fetchedAt"`
+	Planets   []Results     `json:"planets"`
+	Films     []SwapiFilm   `json:"films"`
+	People    []SwapiPerson `json:"people"`
+}
+
+func LoadSnapshot(path string) (*Snapshot, error) {
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := new(Snapshot)
+
+	if err = json.Unmarshal(content, snapshot); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+func (s *Snapshot) Write(path string) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(path, append(content, '\n'))
+}
+
+// BuildSnapshot copies every planet known by client, along with the films and people they link to.
+func BuildSnapshot(ctx context.Context, client SwapiClientInterface, source string) (*Snapshot, error) {
+	snapshot := &Snapshot{Source: source, FetchedAt: time.Now().UTC()}
+	films := map[string]bool{}
+	people := map[string]bool{}
+
+	planets := client.ListPlanets(ctx, "")
+	defer planets.Close()
+
+	for planets.Next() {
+		planet := planets.Planet()
+		snapshot.Planets = append(snapshot.Planets, planet)
+
+		for _, url := range planet.Films {
+			if films[url] {
+				continue
+			}
+			films[url] = true
+
+			film, err := client.GetFilm(ctx, url)
+			if err != nil {
+				return nil, err
+			}
+			if film != nil {
+				snapshot.Films = append(snapshot.Films, *film)
+			}
+		}
+
+		for _, url := range planet.Residents {
+			if people[url] {
+				continue
+			}
+			people[url] = true
+
+			person, err := client.GetPerson(ctx, url)
+			if err != nil {
+				return nil, err
+			}
+			if person != nil {
+				snapshot.People = append(snapshot.People, *person)
+			}
+		}
+	}
+
+	if err := planets.Err(); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// OfflineSwapiClient answers from a snapshot instead of calling SWAPI. Searches match names by substring ignoring
+// case, like SWAPI does, and films and people are found by their SWAPI url whatever its scheme and host.
+type OfflineSwapiClient struct {
+	snapshot *Snapshot
+	films    map[string]SwapiFilm
+	people   map[string]SwapiPerson
+}
+
+func NewOfflineSwapiClient(snapshot *Snapshot) *OfflineSwapiClient {
+	o := new(OfflineSwapiClient)
+	o.snapshot = snapshot
+	o.films = make(map[string]SwapiFilm, len(snapshot.Films))
+	o.people = make(map[string]SwapiPerson, len(snapshot.People))
+
+	for _, film := range snapshot.Films {
+		o.films[resourceKey(film.Url)] = film
+	}
+
+	for _, person := range snapshot.People {
+		o.people[resourceKey(person.Url)] = person
+	}
+
+	return o
+}
+
+func (o *OfflineSwapiClient) GetPlanetByName(ctx context.Context, name string) (*SwapiPlanet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	planets := o.search(name)
+
+	if len(planets) == 0 {
+		return nil, nil
+	}
+
+	return &SwapiPlanet{Count: len(planets), Results: planets}, nil
+}
+
+func (o *OfflineSwapiClient) ListPlanets(ctx context.Context, search string) *PlanetIterator {
+	return NewPlanetIterator(o.search(search))
+}
+
+func (o *OfflineSwapiClient) GetFilm(ctx context.Context, url string) (*SwapiFilm, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	film, ok := o.films[resourceKey(url)]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &film, nil
+}
+
+func (o *OfflineSwapiClient) GetFilms(ctx context.Context, urls []string) ([]SwapiFilm, error) {
+	return getFilms(ctx, o, urls, 1)
+}
+
+func (o *OfflineSwapiClient) GetPerson(ctx context.Context, url string) (*SwapiPerson, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	person, ok := o.people[resourceKey(url)]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &person, nil
+}
+
+func (o *OfflineSwapiClient) GetPeople(ctx context.Context, urls []string) ([]SwapiPerson, error) {
+	return getPeople(ctx, o, urls, 1)
+}
+
+func (o *OfflineSwapiClient) search(name string) []Results {
+	var planets []Results
+
+	name = strings.ToLower(name)
+
+	for _, planet := range o.snapshot.Planets {
+		if strings.Contains(strings.ToLower(planet.Name), name) {
+			planets = append(planets, planet)
+		}
+	}
+
+	return planets
+}
+
+// resourceKey keeps the resource and id of a SWAPI url, so "https://swapi.dev/api/films/1/" becomes "films/1".
+func resourceKey(url string) string {
+	parts := strings.Split(strings.Trim(url, "/"), "/")
+
+	if len(parts) < 2 {
+		return url
+	}
+
+	return parts[len(parts)-2] + "/" + parts[len(parts)-1]
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+// fetchPages sends the page at first and every page after it to pages, in order, then closes pages. It stops
+// early when done is closed.
+// Once the first page tells how many planets there are, the remaining pages are fetched concurrently, at most
+// PageConcurrency at a time; a next link that was already fetched is never fetched again.
+func (s *SwapiClient) fetchPages(ctx context.Context, first string, pages chan<- planetPage, done <-chan struct{}) {
+	defer close(pages)
+
+	visited := map[string]bool{}
+	urls := []string{first}
+
+	for len(urls) > 0 {
+		var last SwapiPlanet
+
+		for i, fetched := range s.fetchAll(ctx, urls) {
+			page := <-fetched
+
+			if i == 0 && len(visited) == 0 && errors.Is(page.err, errNotFound) {
+				return
+			}
+
+			select {
+			case pages <- page:
+			case <-done:
+				return
+			}
+
+			if page.err != nil {
+				return
+			}
+
+			last = page.planets
+		}
+
+		for _, u := range urls {
+			visited[canonicalUrl(u)] = true
+		}
+
+		urls = followingPages(last, visited)
+	}
+}
+
+// fetchAll starts fetching urls, at most PageConcurrency at a time, and returns one channel per url
+// receiving its page.
+func (s *SwapiClient) fetchAll(ctx context.Context, urls []string) []chan planetPage {
+	concurrency := s.config.PageConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	slots := make(chan struct{}, concurrency)
+	fetched := make([]chan planetPage, len(urls))
+
+	for i, u := range urls {
+		fetched[i] = make(chan planetPage, 1)
+
+		go func(u string, result chan<- planetPage) {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				result <- planetPage{err: ctx.Err()}
+				return
+			}
+
+			var page SwapiPlanet
+			validators, err := s.get(ctx, u, &page, Validators{})
+			page.Validators = validators
+			result <- planetPage{planets: page, err: err}
+		}(u, fetched[i])
+	}
+
+	return fetched
+}
+
+// followingPages returns the pages after page that were not visited yet. When page tells the total count and
+// its next link is numbered, every remaining page is listed at once; otherwise only the next link is.
+func followingPages(page SwapiPlanet, visited map[string]bool) []string {
+	if page.Next == "" || visited[canonicalUrl(page.Next)] {
+		return nil
+	}
+
+	next, err := url.Parse(page.Next)
+	if err != nil {
+		return []string{page.Next}
+	}
+
+	query := next.Query()
+	number, err := strconv.Atoi(query.Get("page"))
+	size := len(page.Results)
+
+	if err != nil || size == 0 || page.Count == 0 {
+		return []string{page.Next}
+	}
+
+	urls := []string{page.Next}
+
+	for last := (page.Count + size - 1) / size; number < last; {
+		number++
+		query.Set("page", strconv.Itoa(number))
+		next.RawQuery = query.Encode()
+
+		if u := next.String(); !visited[canonicalUrl(u)] {
+			urls = append(urls, u)
+		}
+	}
+
+	return urls
+}
+
+// canonicalUrl sorts the query of u, so links naming the same page compare equal.
+func canonicalUrl(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+
+	parsed.RawQuery = parsed.Query().Encode()
+
+	return parsed.String()
+}
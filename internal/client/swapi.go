@@ -1,44 +1,322 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
 	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/logger"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 )
 
+var (
+	errNotFound    = errors.New("swapi resource not found")
+	ErrNotModified = errors.New("swapi resource not modified")
+)
+
+// UpstreamError is returned when SWAPI could not answer: it was unreachable, kept answering 5xx or 429 through the
+// retries, or answered an unexpected status.
+type UpstreamError struct {
+	Err error
+}
+
+func (e *UpstreamError) Error() string {
+	return "swapi is unavailable: " + e.Err.Error()
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
 type SwapiClient struct {
-	Endpoint string
-	log      logger.Interface
+	Endpoint   string
+	log        logger.Interface
+	httpClient *http.Client
+	config     config.SwapiConfig
+	breaker    *circuitBreaker
 }
 
 func NewSwapiClient(endpoint string, log logger.Interface) *SwapiClient {
+	return NewSwapiClientWithConfig(endpoint, config.NewDefaultSwapiConfig(), log)
+}
+
+func NewSwapiClientWithConfig(endpoint string, config config.SwapiConfig, log logger.Interface) *SwapiClient {
 	s := new(SwapiClient)
 	s.Endpoint = endpoint
 	s.log = log
+	s.config = config
+	s.httpClient = &http.Client{Timeout: config.Timeout}
+	s.breaker = newCircuitBreaker(config.BreakerThreshold, config.BreakerCooldown)
 	return s
 }
 
-func (s *SwapiClient) GetPlanetByName(name string) (*SwapiPlanet, error) {
-	resp, err := http.Get(s.Endpoint + "planets?search=" + name)
+// GetPlanetByName searches SWAPI for name, gathering every page of results. It returns nil when nothing matched.
+// Results fitting in a single page carry the validators needed to revalidate them later.
+func (s *SwapiClient) GetPlanetByName(ctx context.Context, name string) (*SwapiPlanet, error) {
+	planets := s.ListPlanets(ctx, name)
+	defer planets.Close()
+
+	var swapi SwapiPlanet
+
+	for planets.Next() {
+		swapi.Results = append(swapi.Results, planets.Planet())
+	}
+
+	if err := planets.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(swapi.Results) == 0 {
+		return nil, nil
+	}
+
+	swapi.Count = len(swapi.Results)
+
+	if planets.received == 1 {
+		swapi.Validators = planets.validators
+	}
+
+	return &swapi, nil
+}
+
+// RevalidatePlanetByName repeats the search for name as a conditional request, returning ErrNotModified when the
+// results identified by validators are still current.
+func (s *SwapiClient) RevalidatePlanetByName(ctx context.Context, name string, validators Validators) (*SwapiPlanet, error) {
+	var page SwapiPlanet
+
+	validators, err := s.get(ctx, s.planetsUrl(name), &page, validators)
+
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
 
 	if err != nil {
-		s.log.LogWithFields(nil, "error", map[string]interface{}{"err": "error get planet from swapi client"}, err.Error())
 		return nil, err
 	}
 
-	if resp.StatusCode == http.StatusNotFound {
+	if page.Next != "" {
+		return s.GetPlanetByName(ctx, name)
+	}
+
+	if len(page.Results) == 0 {
+		return nil, nil
+	}
+
+	page.Count = len(page.Results)
+	page.Validators = validators
+
+	return &page, nil
+}
+
+// ListPlanets iterates over every SWAPI planet, or only over those matching search when it is not empty.
+func (s *SwapiClient) ListPlanets(ctx context.Context, search string) *PlanetIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	pages := make(chan planetPage)
+
+	it := newPlanetIterator(pages, cancel)
+
+	go s.fetchPages(ctx, s.planetsUrl(search), pages, it.done)
+
+	return it
+}
+
+// GetFilm fetches the film at url, as linked from a planet. It returns nil when SWAPI does not know it.
+func (s *SwapiClient) GetFilm(ctx context.Context, url string) (*SwapiFilm, error) {
+	var film SwapiFilm
+
+	_, err := s.get(ctx, url, &film, Validators{})
+
+	if errors.Is(err, errNotFound) {
 		return nil, nil
 	}
 
-	var swapi *SwapiPlanet
+	if err != nil {
+		return nil, err
+	}
+
+	return &film, nil
+}
+
+// GetFilms fetches the films at urls, at most PageConcurrency at a time, in the order of urls. Repeated urls are
+// fetched once and films SWAPI does not know are left out.
+func (s *SwapiClient) GetFilms(ctx context.Context, urls []string) ([]SwapiFilm, error) {
+	return getFilms(ctx, s, urls, s.config.PageConcurrency)
+}
+
+// GetPerson fetches the person at url, as linked from a planet. It returns nil when SWAPI does not know it.
+func (s *SwapiClient) GetPerson(ctx context.Context, url string) (*SwapiPerson, error) {
+	var person SwapiPerson
 
-	err = json.NewDecoder(resp.Body).Decode(&swapi)
+	_, err := s.get(ctx, url, &person, Validators{})
+
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &person, nil
+}
+
+// GetPeople fetches the people at urls the way GetFilms fetches films.
+func (s *SwapiClient) GetPeople(ctx context.Context, urls []string) ([]SwapiPerson, error) {
+	return getPeople(ctx, s, urls, s.config.PageConcurrency)
+}
+
+func (s *SwapiClient) planetsUrl(search string) string {
+	if search == "" {
+		return s.Endpoint + "planets"
+	}
+	return s.Endpoint + "planets?search=" + url.QueryEscape(search)
+}
+
+// get fetches url into dst through the circuit breaker, returning errNotFound on 404. When validators are set the
+// request is conditional and ErrNotModified is returned if SWAPI answers 304. The validators of the answer are
+// returned along with it. Calls abandoned because ctx ended do not count as SWAPI failures.
+func (s *SwapiClient) get(ctx context.Context, url string, dst interface{}, validators Validators) (Validators, error) {
+	if !s.breaker.allow() {
+		return Validators{}, &CircuitOpenError{RetryAfter: s.config.BreakerCooldown}
+	}
+
+	resp, err := s.doWithRetry(ctx, url, validators)
+
+	if ctx.Err() != nil {
+		s.breaker.release()
+	} else {
+		s.breaker.record(err == nil)
+	}
+
+	if err != nil {
+		s.log.LogWithFields(nil, "error", map[string]interface{}{"err": "error get planet from swapi client"}, err.Error())
+
+		if ctx.Err() == nil {
+			err = &UpstreamError{Err: err}
+		}
+
+		return Validators{}, err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return validators, ErrNotModified
+	case http.StatusNotFound:
+		return Validators{}, errNotFound
+	default:
+		return Validators{}, &UpstreamError{Err: fmt.Errorf("swapi answered with unexpected status %d", resp.StatusCode)}
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(dst)
 
 	if err != nil {
 		s.log.LogWithFields(nil, "error", map[string]interface{}{"err": "error unmarshalling response"}, err.Error())
 	}
 
-	_ = resp.Body.Close()
+	return Validators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}, err
+}
+
+// doWithRetry performs a GET, retrying network errors, 5xx and 429 answers with exponential backoff and jitter.
+// A Retry-After header is honored unless it asks to wait longer than BackoffMax.
+func (s *SwapiClient) doWithRetry(ctx context.Context, url string, validators Validators) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if validators.ETag != "" {
+		request.Header.Set("If-None-Match", validators.ETag)
+	}
+
+	if validators.LastModified != "" {
+		request.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := s.httpClient.Do(request)
+
+		if err == nil && !retryable(resp.StatusCode) {
+			return resp, nil
+		}
+
+		wait := s.backoff(attempt)
+
+		if err == nil {
+			err = fmt.Errorf("swapi answered with status %d", resp.StatusCode)
+
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				if retryAfter > s.config.BackoffMax {
+					_ = resp.Body.Close()
+					return nil, err
+				}
+				wait = retryAfter
+			}
+
+			_ = resp.Body.Close()
+		}
+
+		if attempt >= s.config.MaxRetries {
+			return nil, err
+		}
+
+		s.log.LogWithFields(nil, "warn", map[string]interface{}{"attempt": attempt + 1, "wait": wait.String()}, err.Error())
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns a random wait in [0, min(BackoffMax, BackoffBase * 2^attempt)).
+func (s *SwapiClient) backoff(attempt int) time.Duration {
+	ceiling := s.config.BackoffBase << uint(attempt)
+
+	if ceiling <= 0 || ceiling > s.config.BackoffMax {
+		ceiling = s.config.BackoffMax
+	}
+
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// parseRetryAfter reads a Retry-After value given either in seconds or as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
 
-	return swapi, err
+	return 0, false
 }
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"sync"
+)
+
+// maxBatchBodyBytes bounds batch bodies, which hold up to BatchConfig.MaxSize planets.
+const maxBatchBodyBytes = 1 << 20
+
+// BatchResult is the outcome of one planet of a batch, in the order of the request: the created planet and its
+// location, or the problem that kept it from being created.
+type BatchResult struct {
+	Status   int             `json:"status"`
+	Location string          `json:"location,omitempty"`
+	Planet   *PlanetResponse `json:"planet,omitempty"`
+	Problem  *Problem        `json:"problem,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// BulkDeleteResponse tells how many planets a bulk delete removed.
+type BulkDeleteResponse struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// SavePlanets creates a batch of planets, at most once per Idempotency-Key. The batch succeeds as a whole even
+// when some of its planets fail; each result has the status its planet would have had on its own. Batches with a
+// server failure are not recorded, so retrying them with the same key runs the failed planets again.
+func (p *PlanetHandler) SavePlanets(w http.ResponseWriter, r *http.Request) {
+	p.idempotent(w, r, maxBatchBodyBytes, p.savePlanets)
+}
+
+func (p *PlanetHandler) savePlanets(w http.ResponseWriter, r *http.Request) {
+	var planetRequests []PlanetRequest
+
+	err := decodeStrict(http.MaxBytesReader(w, r.Body, maxBatchBodyBytes), &planetRequests)
+
+	if err != nil {
+		p.respondWithProblem(w, r, &badRequestError{detail: "request body is not a valid list of planets: " + err.Error()})
+		return
+	}
+
+	if len(planetRequests) == 0 || len(planetRequests) > p.batch.MaxSize {
+		p.respondWithProblem(w, r, &badRequestError{detail: fmt.Sprintf("a batch must have from 1 to %d planets", p.batch.MaxSize)})
+		return
+	}
+
+	planets := make([]*repository.Planet, len(planetRequests))
+	errs := make([]error, len(planetRequests))
+
+	for i, planetRequest := range planetRequests {
+		planets[i], errs[i] = newPlanet(planetRequest)
+	}
+
+	p.enrichAll(r.Context(), planets, errs)
+
+	valid := make([]*repository.Planet, 0, len(planets))
+
+	for i, planet := range planets {
+		if errs[i] == nil {
+			valid = append(valid, planet)
+		}
+	}
+
+	if len(valid) > 0 {
+		ctx, cancel := withTimeout(r.Context(), p.timeouts.Write)
+		insertErrs := p.repository.InsertMany(ctx, valid)
+		cancel()
+
+		for i, j := 0, 0; i < len(planets); i++ {
+			if errs[i] == nil {
+				errs[i] = insertErrs[j]
+				j++
+			}
+		}
+	}
+
+	results := make([]BatchResult, len(planets))
+
+	for i, planet := range planets {
+		results[i] = p.batchResult(r, planet, errs[i])
+
+		if results[i].Status >= http.StatusInternalServerError {
+			dontRecord(w)
+		}
+	}
+
+	respondWithJson(w, http.StatusOK, BatchResponse{Results: results})
+}
+
+// newPlanet builds the planet to create from planetRequest, defaulting its source.
+func newPlanet(planetRequest PlanetRequest) (*repository.Planet, error) {
+	if fieldErrors := planetRequest.Validate(); fieldErrors != nil {
+		return nil, &validationError{fields: fieldErrors}
+	}
+
+	planet := new(repository.Planet)
+
+	planet.Id = primitive.NewObjectID()
+	planet.Name = planetRequest.Name
+	planet.Land = planetRequest.Land
+	planet.Weather = planetRequest.Weather
+	planet.Source = planetRequest.Source
+
+	if planet.Source == "" {
+		planet.Source = repository.SourceSwapi
+	}
+
+	return planet, nil
+}
+
+// enrichAll looks the valid SWAPI planets up, at most BatchConfig.Concurrency at once, recording failures in errs.
+func (p *PlanetHandler) enrichAll(ctx context.Context, planets []*repository.Planet, errs []error) {
+	concurrency := p.batch.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+
+	for i, planet := range planets {
+		if errs[i] != nil || planet.Source != repository.SourceSwapi {
+			continue
+		}
+
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(i int, planet *repository.Planet) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			errs[i] = enrich(ctx, p.swapiClient, p.timeouts.Swapi, planet)
+		}(i, planet)
+	}
+
+	wg.Wait()
+}
+
+func (p *PlanetHandler) batchResult(r *http.Request, planet *repository.Planet, err error) BatchResult {
+	if err == nil {
+		response := newPlanetResponse(planet)
+		return BatchResult{Status: http.StatusCreated, Location: planetLocation(planet.Id), Planet: &response}
+	}
+
+	problem := problemFor(err)
+	problem.Instance = requestId(r)
+
+	if problem.Status >= http.StatusInternalServerError {
+		p.log.LogWithFields(r, "error", map[string]interface{}{"status": problem.Status, "type": problem.Type},
+			fmt.Sprintf("error creating planet in batch: %s", err))
+	}
+
+	return BatchResult{Status: problem.Status, Problem: &problem}
+}
+
+// RemovePlanets deletes every planet matching the filtering parameters. Since an empty filter matches every planet,
+// the request must carry confirm=true.
+func (p *PlanetHandler) RemovePlanets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("confirm") != "true" {
+		p.respondWithProblem(w, r, &badRequestError{detail: "deleting planets in bulk needs confirm=true"})
+		return
+	}
+
+	query.Del("confirm")
+
+	filter, err := decodeFilter(query)
+
+	if err != nil {
+		p.respondWithProblem(w, r, &badRequestError{detail: err.Error()})
+		return
+	}
+
+	if filter.Sort != "" || filter.Limit != 0 || filter.Offset != 0 || filter.After != "" || filter.Before != "" {
+		p.respondWithProblem(w, r, &badRequestError{detail: "deleting planets in bulk takes no sort or pagination parameters"})
+		return
+	}
+
+	ctx, cancel := withTimeout(r.Context(), p.timeouts.Write)
+	defer cancel()
+
+	deleted, err := p.repository.DeleteMany(ctx, *filter)
+
+	if err != nil {
+		p.respondWithProblem(w, r, fmt.Errorf("error removing planets: %w", err))
+		return
+	}
+
+	p.log.LogWithFields(r, "info", map[string]interface{}{"deleted": deleted}, "planets removed in bulk")
+
+	respondWithJson(w, http.StatusOK, BulkDeleteResponse{Deleted: deleted})
+}
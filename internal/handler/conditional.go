@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errPreconditionFailed = errors.New("planet does not match If-Match")
+
+// planetETag is the strong entity tag of planet, changing with each of its versions.
+func planetETag(planet *repository.Planet) string {
+	return `"` + planet.Id.Hex() + "-" + strconv.FormatInt(planet.Version, 10) + `"`
+}
+
+// bodyETag tags a representation spanning several planets by hashing it.
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagListed reports whether etag is one of the entity tags of an If-Match or If-None-Match header, "*" listing
+// every tag. Weak tags only match with weak comparison, as If-None-Match uses.
+func etagListed(header string, etag string, weak bool) bool {
+	for _, listed := range strings.Split(header, ",") {
+		listed = strings.TrimSpace(listed)
+
+		if listed == "*" {
+			return true
+		}
+
+		if weak {
+			listed = strings.TrimPrefix(listed, "W/")
+		}
+
+		if listed == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch returns errPreconditionFailed unless r has no If-Match header or one listing the ETag of planet.
+func checkIfMatch(r *http.Request, planet *repository.Planet) error {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagListed(ifMatch, planetETag(planet), false) {
+		return errPreconditionFailed
+	}
+	return nil
+}
+
+// conditional reports a planet changed between the If-Match check and the write as a failed precondition.
+func conditional(r *http.Request, err error) error {
+	if r.Header.Get("If-Match") != "" && errors.Is(err, repository.ErrVersionConflict) {
+		return errPreconditionFailed
+	}
+	return err
+}
+
+// respondWithTaggedJson writes payload tagged with etag, or with a hash of payload when etag is empty. Reads
+// whose If-None-Match already lists the tag are answered 304 without a body.
+func respondWithTaggedJson(w http.ResponseWriter, r *http.Request, code int, payload interface{}, etag string) {
+	response, _ := json.Marshal(payload)
+
+	if etag == "" {
+		etag = bodyETag(response)
+	}
+
+	w.Header().Set("ETag", etag)
+
+	isRead := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); isRead && ifNoneMatch != "" && etagListed(ifNoneMatch, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", apiContentType)
+
+	w.WriteHeader(code)
+	_, _ = w.Write(response)
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/client"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// leadingNumber finds the number a SWAPI value starts with, as in "1.5 (surface), 1 standard (Cloud City)".
+var leadingNumber = regexp.MustCompile(`^\s*([0-9]+(\.[0-9]+)?)`)
+
+// enrich looks planet up in SWAPI by name and copies what SWAPI tells about it, including its films, within
+// timeout.
+func enrich(ctx context.Context, swapiClient client.SwapiClientInterface, timeout time.Duration, planet *repository.Planet) error {
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+
+	swapiPlanet, err := findSwapiPlanet(ctx, swapiClient, planet.Name)
+
+	if err != nil {
+		return err
+	}
+
+	films, err := swapiClient.GetFilms(ctx, swapiPlanet.Films)
+
+	if err != nil {
+		return fmt.Errorf("error getting films of planet %s from swapi: %w", planet.Name, err)
+	}
+
+	planet.AppearanceQuantity = len(swapiPlanet.Films)
+	planet.Swapi = swapiData(swapiPlanet)
+	planet.Films = filmsOf(films)
+
+	syncedAt := time.Now().UTC()
+	planet.SyncedAt = &syncedAt
+
+	return nil
+}
+
+// findSwapiPlanet returns the SWAPI planet named exactly name, failing with a client.MatchError when there is
+// no such planet or several of them.
+func findSwapiPlanet(ctx context.Context, swapiClient client.SwapiClientInterface, name string) (*client.Results, error) {
+	planets, err := swapiClient.GetPlanetByName(ctx, name)
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting planet %s from swapi: %w", name, err)
+	}
+
+	return planets.Match(name)
+}
+
+// resolveFilms looks up the films at urls, for planets stored before their films were kept.
+func (p *PlanetHandler) resolveFilms(ctx context.Context, urls []string) ([]repository.Film, error) {
+	ctx, cancel := withTimeout(ctx, p.timeouts.Swapi)
+	defer cancel()
+
+	films, err := p.swapiClient.GetFilms(ctx, urls)
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting films from swapi: %w", err)
+	}
+
+	return filmsOf(films), nil
+}
+
+func filmsOf(swapiFilms []client.SwapiFilm) []repository.Film {
+	films := make([]repository.Film, 0, len(swapiFilms))
+
+	for _, film := range swapiFilms {
+		films = append(films, repository.Film{Title: film.Title, EpisodeId: film.EpisodeId, ReleaseDate: film.ReleaseDate, Url: film.Url})
+	}
+
+	return films
+}
+
+// swapiData keeps what SWAPI tells about planet, parsing the numbers SWAPI sends as strings.
+func swapiData(planet *client.Results) *repository.SwapiData {
+	return &repository.SwapiData{
+		Url:        planet.Url,
+		Diameter:   parseSwapiInt(planet.Diameter),
+		Gravity:    parseSwapiFloat(planet.Gravity),
+		Population: parseSwapiInt(planet.Population),
+		Climate:    splitSwapiList(planet.Climate),
+		Terrain:    splitSwapiList(planet.Terrain),
+		Residents:  append([]string{}, planet.Residents...),
+		Films:      append([]string{}, planet.Films...),
+	}
+}
+
+// parseSwapiInt returns nil for "unknown" and any other value that is not a whole number.
+func parseSwapiInt(value string) *int64 {
+	number, err := strconv.ParseInt(strings.Replace(strings.TrimSpace(value), ",", "", -1), 10, 64)
+
+	if err != nil {
+		return nil
+	}
+
+	return &number
+}
+
+func parseSwapiFloat(value string) *float64 {
+	match := leadingNumber.FindStringSubmatch(value)
+
+	if match == nil {
+		return nil
+	}
+
+	number, err := strconv.ParseFloat(match[1], 64)
+
+	if err != nil {
+		return nil
+	}
+
+	return &number
+}
+
+func splitSwapiList(value string) []string {
+	values := make([]string, 0)
+
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" && part != "unknown" && part != "none" {
+			values = append(values, part)
+		}
+	}
+
+	return values
+}
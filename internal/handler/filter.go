@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"github.com/gorilla/schema"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const maxFilterValueLength = 100
+
+// decodeFilter reads the filtering and pagination parameters of query and normalizes the filter. Unknown parameters
+// are rejected, so a misspelled filter does not silently match every planet.
+func decodeFilter(query url.Values) (*repository.Filter, error) {
+	filter := new(repository.Filter)
+	err := decoder.Decode(filter, query)
+
+	var multi schema.MultiError
+
+	if errors.As(err, &multi) {
+		keys := make([]string, 0, len(multi))
+		for key := range multi {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if unknown, ok := multi[key].(schema.UnknownKeyError); ok {
+				return nil, fmt.Errorf("unknown query parameter %s", unknown.Key)
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return filter, normalizeFilter(filter)
+}
+
+// normalizeFilter splits comma separated values of filter and validates the filtering parameters.
+func normalizeFilter(filter *repository.Filter) error {
+	filter.Weather = splitValues(filter.Weather)
+	filter.Land = splitValues(filter.Land)
+	filter.Climate = splitValues(filter.Climate)
+	filter.Terrain = splitValues(filter.Terrain)
+	filter.Film = splitValues(filter.Film)
+
+	values := []string{filter.Name, filter.NamePrefix, filter.NameContains}
+
+	for _, list := range [][]string{filter.Weather, filter.Land, filter.Climate, filter.Terrain, filter.Film} {
+		values = append(values, list...)
+	}
+
+	for _, value := range values {
+		if len(value) > maxFilterValueLength {
+			return errors.New("filter values must have at most 100 characters")
+		}
+	}
+
+	for _, bound := range []*int{filter.AppearanceQuantityGt, filter.AppearanceQuantityGte,
+		filter.AppearanceQuantityLt, filter.AppearanceQuantityLte} {
+		if bound != nil && *bound < 0 {
+			return errors.New("appearanceQuantity bounds must not be negative")
+		}
+	}
+
+	for _, lower := range []*int{filter.AppearanceQuantityGt, filter.AppearanceQuantityGte} {
+		for _, upper := range []*int{filter.AppearanceQuantityLt, filter.AppearanceQuantityLte} {
+			if lower != nil && upper != nil && *lower > *upper {
+				return errors.New("appearanceQuantity lower bound must not be greater than the upper bound")
+			}
+		}
+	}
+
+	if filter.Source != "" && filter.Source != repository.SourceSwapi && filter.Source != repository.SourceCustom {
+		return errors.New("source must be swapi or custom")
+	}
+
+	if filter.MinResidents != nil && *filter.MinResidents < 0 {
+		return errors.New("minResidents must not be negative")
+	}
+
+	for name, bounds := range map[string][2]*int64{
+		"diameter":   {filter.DiameterGte, filter.DiameterLte},
+		"population": {filter.PopulationGte, filter.PopulationLte},
+	} {
+		lower, upper := bounds[0], bounds[1]
+
+		if (lower != nil && *lower < 0) || (upper != nil && *upper < 0) {
+			return errors.New(name + " bounds must not be negative")
+		}
+
+		if lower != nil && upper != nil && *lower > *upper {
+			return errors.New(name + " lower bound must not be greater than the upper bound")
+		}
+	}
+
+	return nil
+}
+
+// splitValues flattens repeated and comma separated query values, dropping empty entries.
+func splitValues(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	result := make([]string, 0, len(values))
+
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+
+	return result
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	maxIdempotencyKeyLength  = 255
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// replayedHeaders are the response headers kept with an idempotency record. Others, like the request id, belong
+// to a single request.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location", "Preference-Applied"}
+
+// pendingIdempotencyTTL bounds how long a key stays reserved by a request that never finished, for instance
+// because the server stopped while running it.
+const pendingIdempotencyTTL = time.Minute
+
+var (
+	errIdempotencyKeyReused        = errors.New("idempotency key was already used with another request")
+	errIdempotentRequestInProgress = errors.New("a request with this idempotency key is still running")
+)
+
+// idempotent runs handle once per Idempotency-Key, reading request bodies of at most maxBytes, answering retries carrying the same key and body with the
+// recorded response. The key is reserved before handle runs, so retries arriving meanwhile are refused instead of
+// running again. Only successful responses are recorded; otherwise, or when handle calls dontRecord, the key is
+// released so the request can be retried.
+func (p *PlanetHandler) idempotent(w http.ResponseWriter, r *http.Request, maxBytes int64, handle http.HandlerFunc) {
+	key := r.Header.Get(idempotencyKeyHeader)
+
+	if key == "" {
+		handle(w, r)
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		p.respondWithProblem(w, r, &badRequestError{detail: fmt.Sprintf("%s must have at most %d characters",
+			idempotencyKeyHeader, maxIdempotencyKeyLength)})
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+
+	if err != nil {
+		p.respondWithProblem(w, r, &badRequestError{detail: "request body is not a valid planet: " + err.Error()})
+		return
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	hash := requestHash(r, body)
+
+	if !p.reserve(w, r, key, hash) {
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+	handle(recorder, r)
+
+	writeCtx, cancel := withTimeout(r.Context(), p.timeouts.Write)
+	defer cancel()
+
+	if recorder.status < http.StatusOK || recorder.status >= http.StatusMultipleChoices || recorder.dontRecord {
+		if err = p.repository.DeleteIdempotencyRecord(writeCtx, key); err != nil {
+			p.log.LogWithFields(r, "warn", map[string]interface{}{"key": key, "err": err.Error()}, "error releasing idempotency key")
+		}
+		return
+	}
+
+	record := &repository.IdempotencyRecord{Key: key, RequestHash: hash, Status: recorder.status,
+		Header: make(map[string]string), Body: recorder.body.Bytes(),
+		ExpiresAt: time.Now().Add(p.idempotency.TTL).UTC().Truncate(time.Millisecond)}
+
+	for _, name := range replayedHeaders {
+		if value := w.Header().Get(name); value != "" {
+			record.Header[name] = value
+		}
+	}
+
+	if err = p.repository.ReplaceIdempotencyRecord(writeCtx, record); err != nil {
+		p.log.LogWithFields(r, "warn", map[string]interface{}{"key": key, "err": err.Error()}, "error saving idempotency key")
+	}
+}
+
+// reserve saves a pending record for key, reporting whether the request may run. When the key is already taken
+// it answers from the record holding it instead.
+func (p *PlanetHandler) reserve(w http.ResponseWriter, r *http.Request, key string, hash string) bool {
+	pending := &repository.IdempotencyRecord{Key: key, RequestHash: hash, Header: map[string]string{}, Body: []byte{},
+		ExpiresAt: time.Now().Add(pendingIdempotencyTTL).UTC().Truncate(time.Millisecond)}
+
+	writeCtx, cancelWrite := withTimeout(r.Context(), p.timeouts.Write)
+	err := p.repository.SaveIdempotencyRecord(writeCtx, pending)
+	cancelWrite()
+
+	if err == nil {
+		return true
+	}
+
+	if !errors.Is(err, repository.ErrIdempotencyKeyExists) {
+		p.respondWithProblem(w, r, fmt.Errorf("error reserving idempotency key: %w", err))
+		return false
+	}
+
+	readCtx, cancelRead := withTimeout(r.Context(), p.timeouts.Read)
+	record, err := p.repository.FindIdempotencyRecord(readCtx, key)
+	cancelRead()
+
+	switch {
+	case errors.Is(err, repository.ErrIdempotencyKeyNotFound):
+		p.respondWithProblem(w, r, errIdempotentRequestInProgress)
+	case err != nil:
+		p.respondWithProblem(w, r, fmt.Errorf("error finding idempotency key: %w", err))
+	case record.RequestHash != hash:
+		p.respondWithProblem(w, r, errIdempotencyKeyReused)
+	case record.Pending():
+		p.respondWithProblem(w, r, errIdempotentRequestInProgress)
+	default:
+		replay(w, record)
+	}
+
+	return false
+}
+
+// requestHash identifies a request by its method, path and body.
+func requestHash(r *http.Request, body []byte) string {
+	hash := sha256.New()
+
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, record *repository.IdempotencyRecord) {
+	for name, value := range record.Header {
+		w.Header().Set(name, value)
+	}
+
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(record.Status)
+	_, _ = w.Write(record.Body)
+}
+
+// responseRecorder copies the status and body written through it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status     int
+	body       bytes.Buffer
+	dontRecord bool
+}
+
+// dontRecord keeps a successful response from being replayed, for responses reporting failures worth retrying.
+func dontRecord(w http.ResponseWriter) {
+	if recorder, ok := w.(*responseRecorder); ok {
+		recorder.dontRecord = true
+	}
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
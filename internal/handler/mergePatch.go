@@ -0,0 +1,27 @@
+package handler
+
+// mergePatch applies a JSON Merge Patch (RFC 7396) to target and returns the result.
+// Both values are expected to come from encoding/json decoding into interface{}.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+
+	return targetObject
+}
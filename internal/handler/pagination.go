@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type PlanetPage struct {
+	Total   int64            `json:"total"`
+	Limit   int64            `json:"limit"`
+	Offset  int64            `json:"offset,omitempty"`
+	Results []PlanetResponse `json:"results"`
+	Links   PageLinks        `json:"links"`
+}
+
+type PageLinks struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// normalizePagination validates the pagination parameters of filter and applies the default limit.
+func normalizePagination(filter *repository.Filter) error {
+	if filter.Limit < 0 || filter.Offset < 0 {
+		return errors.New("limit and offset must not be negative")
+	}
+
+	if filter.Limit > maxPageLimit {
+		return fmt.Errorf("limit must be at most %d", maxPageLimit)
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = defaultPageLimit
+	}
+
+	if !repository.ValidSort(filter.Sort) {
+		return errors.New("sort must be one of name, appearanceQuantity, -name or -appearanceQuantity")
+	}
+
+	if filter.After != "" && filter.Before != "" {
+		return errors.New("after and before can not be used together")
+	}
+
+	for _, cursor := range []string{filter.After, filter.Before} {
+		if cursor == "" {
+			continue
+		}
+
+		if !filter.Keyset() {
+			return errors.New("after and before can not be used with sort or offset")
+		}
+
+		if _, err := primitive.ObjectIDFromHex(cursor); err != nil {
+			return errors.New("after and before must be valid planet ids")
+		}
+	}
+
+	return nil
+}
+
+// pageLinks builds the next and prev links for the page of planets returned for filter.
+func pageLinks(r *http.Request, filter repository.Filter, planets []repository.Planet, total int64) PageLinks {
+	links := PageLinks{}
+
+	if filter.Keyset() {
+		if len(planets) == 0 {
+			return links
+		}
+
+		first, last := planets[0].Id.Hex(), planets[len(planets)-1].Id.Hex()
+		full := int64(len(planets)) == filter.Limit
+
+		if full || filter.Before != "" {
+			links.Next = pageLink(r, map[string]string{"after": last})
+		}
+
+		if filter.After != "" || (filter.Before != "" && full) {
+			links.Prev = pageLink(r, map[string]string{"before": first})
+		}
+
+		return links
+	}
+
+	if filter.Offset+int64(len(planets)) < total {
+		links.Next = pageLink(r, map[string]string{"offset": strconv.FormatInt(filter.Offset+filter.Limit, 10)})
+	}
+
+	if filter.Offset > 0 {
+		prev := filter.Offset - filter.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		links.Prev = pageLink(r, map[string]string{"offset": strconv.FormatInt(prev, 10)})
+	}
+
+	return links
+}
+
+// pageLink returns the request path and query with the cursor parameters replaced by params.
+func pageLink(r *http.Request, params map[string]string) string {
+	query := url.Values{}
+
+	for key, values := range r.URL.Query() {
+		query[key] = values
+	}
+
+	query.Del("after")
+	query.Del("before")
+	query.Del("offset")
+
+	for key, value := range params {
+		query.Set(key, value)
+	}
+
+	return r.URL.Path + "?" + query.Encode()
+}
@@ -1,31 +1,41 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
 	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/client"
 	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/logger"
 	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"log"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 )
 
-type PlanetRequest struct {
-	Name    string `bson:"name"`
-	Weather string `bson:"weather"`
-	Land    string `bson:"land"`
-}
+const mergePatchContentType = "application/merge-patch+json"
 
-type ResponseError struct {
-	Description string `json:"description"`
+// PlanetRequest is the body of the planet writes. Source defaults to repository.SourceSwapi on creation and to the
+// stored source on updates, where it cannot change.
+type PlanetRequest struct {
+	Name    string `json:"name" bson:"name"`
+	Weather string `json:"weather" bson:"weather"`
+	Land    string `json:"land" bson:"land"`
+	Source  string `json:"source" bson:"source"`
 }
 
 type PlanetHandler struct {
 	swapiClient client.SwapiClientInterface
 	repository  repository.PlanetRepositoryInterface
 	log         logger.Interface
+	timeouts    config.TimeoutConfig
+	idempotency config.IdempotencyConfig
+	batch       config.BatchConfig
 }
 
 var decoder = schema.NewDecoder()
@@ -34,28 +44,73 @@ func NewPlanetHandler(mongo repository.PlanetRepositoryInterface,
 	swapiClient client.SwapiClientInterface,
 	logger logger.Interface) *PlanetHandler {
 
+	return NewPlanetHandlerWithTimeouts(mongo, swapiClient, logger, config.NewDefaultTimeoutConfig())
+}
+
+func NewPlanetHandlerWithTimeouts(mongo repository.PlanetRepositoryInterface,
+	swapiClient client.SwapiClientInterface,
+	logger logger.Interface,
+	timeouts config.TimeoutConfig) *PlanetHandler {
+
+	return NewPlanetHandlerWithConfig(mongo, swapiClient, logger, timeouts, config.NewDefaultIdempotencyConfig(),
+		config.NewDefaultBatchConfig())
+}
+
+func NewPlanetHandlerWithConfig(mongo repository.PlanetRepositoryInterface,
+	swapiClient client.SwapiClientInterface,
+	logger logger.Interface,
+	timeouts config.TimeoutConfig,
+	idempotency config.IdempotencyConfig,
+	batch config.BatchConfig) *PlanetHandler {
+
 	planetHandler := new(PlanetHandler)
 
 	planetHandler.swapiClient = swapiClient
 	planetHandler.repository = mongo
 	planetHandler.log = logger
+	planetHandler.timeouts = timeouts
+	planetHandler.idempotency = idempotency
+	planetHandler.batch = batch
 
 	return planetHandler
 }
 
 func (p *PlanetHandler) GetPlanets(w http.ResponseWriter, r *http.Request) {
-	filter := new(repository.Filter)
-	err := decoder.Decode(filter, r.URL.Query())
+	filter, err := decodeFilter(r.URL.Query())
+
+	if err == nil {
+		err = normalizePagination(filter)
+	}
+
+	if err != nil {
+		p.respondWithProblem(w, r, &badRequestError{detail: err.Error()})
+		return
+	}
+
+	ctx, cancel := withTimeout(r.Context(), p.timeouts.Read)
+	defer cancel()
+
+	planets, err := p.repository.FindAll(ctx, *filter)
+
+	if err != nil {
+		p.respondWithProblem(w, r, fmt.Errorf("error finding planets: %w", err))
+		return
+	}
 
-	planets, err := p.repository.FindAll(*filter)
+	total, err := p.repository.Count(ctx, *filter)
 
 	if err != nil {
-		p.log.LogWithFields(r, "error", nil, err.Error())
-		respondWithJson(w, http.StatusInternalServerError, ResponseError{Description: err.Error()})
+		p.respondWithProblem(w, r, fmt.Errorf("error counting planets: %w", err))
 		return
 	}
 
-	respondWithJson(w, http.StatusOK, planets)
+	respondWithTaggedJson(w, r, http.StatusOK, PlanetPage{
+		Total:   total,
+		Limit:   filter.Limit,
+		Offset:  filter.Offset,
+		Results: newPlanetResponses(*planets),
+		Links:   pageLinks(r, *filter, *planets, total),
+	}, "")
 }
 
 func (p *PlanetHandler) GetPlanetById(w http.ResponseWriter, r *http.Request) {
@@ -63,20 +118,87 @@ func (p *PlanetHandler) GetPlanetById(w http.ResponseWriter, r *http.Request) {
 
 	objectId, err := primitive.ObjectIDFromHex(vars["planetId"])
 	if err != nil {
-		p.log.LogWithFields(r, "info", nil, "planet id is not a valid id")
-		respondWithJson(w, http.StatusBadRequest, ResponseError{Description: "planet id is not a valid id"})
+		p.respondWithProblem(w, r, errInvalidPlanetId)
+		return
+	}
+
+	ctx, cancel := withTimeout(r.Context(), p.timeouts.Read)
+	defer cancel()
+
+	foundPlanet, err := p.repository.FindById(ctx, objectId)
+
+	if err != nil {
+		p.respondWithProblem(w, r, fmt.Errorf("error finding planet %s: %w", objectId.Hex(), err))
+		return
+	}
+
+	respondWithTaggedJson(w, r, http.StatusOK, newPlanetResponse(foundPlanet), planetETag(foundPlanet))
+}
+
+func (p *PlanetHandler) GetPlanetFilms(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	objectId, err := primitive.ObjectIDFromHex(vars["planetId"])
+	if err != nil {
+		p.respondWithProblem(w, r, errInvalidPlanetId)
 		return
 	}
 
-	foundPlanet, err := p.repository.FindById(objectId)
+	ctx, cancel := withTimeout(r.Context(), p.timeouts.Read)
+	defer cancel()
+
+	foundPlanet, err := p.repository.FindById(ctx, objectId)
 
 	if err != nil {
-		p.log.LogWithFields(r, "error", nil, err.Error())
-		respondWithJson(w, http.StatusInternalServerError, ResponseError{Description: err.Error()})
+		p.respondWithProblem(w, r, fmt.Errorf("error finding planet %s: %w", objectId.Hex(), err))
 		return
 	}
 
-	respondWithJson(w, http.StatusOK, foundPlanet)
+	films := foundPlanet.Films
+
+	if films == nil && foundPlanet.Swapi != nil {
+		films, err = p.resolveFilms(r.Context(), foundPlanet.Swapi.Films)
+
+		if err != nil {
+			p.respondWithProblem(w, r, err)
+			return
+		}
+	}
+
+	respondWithJson(w, http.StatusOK, newFilmResponses(films))
+}
+
+func (p *PlanetHandler) GetPlanetResidents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	objectId, err := primitive.ObjectIDFromHex(vars["planetId"])
+	if err != nil {
+		p.respondWithProblem(w, r, errInvalidPlanetId)
+		return
+	}
+
+	ctx, cancel := withTimeout(r.Context(), p.timeouts.Read)
+	defer cancel()
+
+	foundPlanet, err := p.repository.FindById(ctx, objectId)
+
+	if err != nil {
+		p.respondWithProblem(w, r, fmt.Errorf("error finding planet %s: %w", objectId.Hex(), err))
+		return
+	}
+
+	residents := make([]Resident, 0)
+
+	if foundPlanet.Swapi != nil && len(foundPlanet.Swapi.Residents) > 0 {
+		residents, err = p.resolveResidents(r.Context(), foundPlanet.Swapi.Residents)
+
+		if err != nil {
+			p.respondWithProblem(w, r, err)
+			return
+		}
+	}
+
+	respondWithJson(w, http.StatusOK, residents)
 }
 
 func (p *PlanetHandler) RemovePlanetById(w http.ResponseWriter, r *http.Request) {
@@ -84,68 +206,284 @@ func (p *PlanetHandler) RemovePlanetById(w http.ResponseWriter, r *http.Request)
 
 	objectId, err := primitive.ObjectIDFromHex(vars["planetId"])
 	if err != nil {
-		p.log.LogWithFields(r, "info", nil, "planet id is not a valid id")
-		respondWithJson(w, http.StatusBadRequest, ResponseError{Description: "planet id is not a valid id"})
+		p.respondWithProblem(w, r, errInvalidPlanetId)
 		return
 	}
 
-	err = p.repository.Delete(objectId)
+	if r.Header.Get("If-Match") != "" {
+		err = p.removeMatchingPlanet(r, objectId)
+	} else {
+		ctx, cancel := withTimeout(r.Context(), p.timeouts.Write)
+		err = p.repository.Delete(ctx, objectId)
+		cancel()
+	}
 
 	if err != nil {
-		p.log.LogWithFields(r, "error", nil, err.Error())
-		respondWithJson(w, http.StatusInternalServerError, ResponseError{Description: err.Error()})
+		p.respondWithProblem(w, r, fmt.Errorf("error removing planet %s: %w", objectId.Hex(), err))
 		return
 	}
 
 	respondWithEmpty(w, http.StatusNoContent, "")
 }
 
+// SavePlanet creates a planet, at most once per Idempotency-Key.
 func (p *PlanetHandler) SavePlanet(w http.ResponseWriter, r *http.Request) {
+	p.idempotent(w, r, maxBodyBytes, p.savePlanet)
+}
+
+func (p *PlanetHandler) savePlanet(w http.ResponseWriter, r *http.Request) {
+
+	var planetRequest PlanetRequest
+
+	err := decodeBody(w, r, &planetRequest)
+
+	if err != nil {
+		p.respondWithProblem(w, r, &badRequestError{detail: "request body is not a valid planet: " + err.Error()})
+		return
+	}
+
+	planet, err := newPlanet(planetRequest)
+
+	if err != nil {
+		p.respondWithProblem(w, r, err)
+		return
+	}
+
+	if planet.Source == repository.SourceSwapi {
+		if err = enrich(r.Context(), p.swapiClient, p.timeouts.Swapi, planet); err != nil {
+			p.respondWithProblem(w, r, err)
+			return
+		}
+	}
+
+	ctx, cancel := withTimeout(r.Context(), p.timeouts.Write)
+	defer cancel()
+
+	savedPlanet, err := p.repository.Save(ctx, planet)
+
+	if err != nil {
+		p.respondWithProblem(w, r, fmt.Errorf("error creating planet %s: %w", planet.Name, err))
+		return
+	}
+
+	location := planetLocation(savedPlanet.Id)
+
+	if prefersMinimal(r) {
+		w.Header().Set("ETag", planetETag(savedPlanet))
+		w.Header().Set("Preference-Applied", "return=minimal")
+		respondWithEmpty(w, http.StatusCreated, location)
+		return
+	}
+
+	w.Header().Set("Location", location)
+	respondWithTaggedJson(w, r, http.StatusCreated, newPlanetResponse(savedPlanet), planetETag(savedPlanet))
+}
+
+func (p *PlanetHandler) UpdatePlanet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	objectId, err := primitive.ObjectIDFromHex(vars["planetId"])
+	if err != nil {
+		p.respondWithProblem(w, r, errInvalidPlanetId)
+		return
+	}
 
 	var planetRequest PlanetRequest
 
-	err := json.NewDecoder(r.Body).Decode(&planetRequest)
+	err = decodeBody(w, r, &planetRequest)
 
 	if err != nil {
-		p.log.LogWithFields(r, "error", nil, err.Error())
-		log.Println("error unmarshalling the request body", err)
+		p.respondWithProblem(w, r, &badRequestError{detail: "request body is not a valid planet: " + err.Error()})
+		return
+	}
+
+	p.replacePlanet(w, r, objectId, planetRequest, nil)
+}
+
+// PatchPlanet applies an RFC 7396 merge patch, which must be sent as application/merge-patch+json.
+func (p *PlanetHandler) PatchPlanet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	objectId, err := primitive.ObjectIDFromHex(vars["planetId"])
+	if err != nil {
+		p.respondWithProblem(w, r, errInvalidPlanetId)
+		return
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != mergePatchContentType {
+		w.Header().Set("Accept-Patch", mergePatchContentType)
+		p.respondWithProblem(w, r, errUnsupportedMediaType)
+		return
 	}
 
-	planets, err := p.swapiClient.GetPlanetByName(planetRequest.Name)
+	var patch map[string]interface{}
+
+	err = decodeBody(w, r, &patch)
+
+	if err != nil || patch == nil {
+		p.respondWithProblem(w, r, &badRequestError{detail: "request body is not a valid merge patch"})
+		return
+	}
+
+	p.replacePlanet(w, r, objectId, PlanetRequest{}, patch)
+}
+
+// replacePlanet loads the stored planet, applies either the full planetRequest or, when patch is not nil,
+// the merge patch over the stored values, and persists the result keeping the same id.
+func (p *PlanetHandler) replacePlanet(w http.ResponseWriter, r *http.Request, id primitive.ObjectID,
+	planetRequest PlanetRequest, patch map[string]interface{}) {
+
+	readCtx, cancelRead := withTimeout(r.Context(), p.timeouts.Read)
+	defer cancelRead()
+
+	foundPlanet, err := p.repository.FindById(readCtx, id)
 
 	if err != nil {
-		p.log.LogWithFields(r, "error", map[string]interface{}{"err": "error getting planets from swapi api"}, err.Error())
-		respondWithJson(w, http.StatusInternalServerError, ResponseError{Description: err.Error()})
+		p.respondWithProblem(w, r, fmt.Errorf("error finding planet %s: %w", id.Hex(), err))
 		return
 	}
 
-	if planets == nil {
-		p.log.LogWithFields(r, "info", map[string]interface{}{"planet": planetRequest.Name}, "planet not found")
-		respondWithEmpty(w, http.StatusNotFound, "")
+	if err = checkIfMatch(r, foundPlanet); err != nil {
+		p.respondWithProblem(w, r, err)
 		return
 	}
 
-	planet := new(repository.Planet)
+	if patch != nil {
+		planetRequest, err = applyPlanetPatch(foundPlanet, patch)
+
+		if err != nil {
+			p.respondWithProblem(w, r, &badRequestError{detail: "request body is not a valid merge patch: " + err.Error()})
+			return
+		}
+	}
+
+	source := sourceOf(foundPlanet)
+
+	if planetRequest.Source == "" {
+		planetRequest.Source = source
+	}
+
+	fieldErrors := planetRequest.Validate()
+
+	if planetRequest.Source != source {
+		fieldErrors = append(fieldErrors, FieldError{Field: "source", Message: "cannot be changed"})
+	}
+
+	if fieldErrors != nil {
+		p.respondWithProblem(w, r, &validationError{fields: fieldErrors})
+		return
+	}
+
+	planet := *foundPlanet
 
-	planet.Id = primitive.NewObjectID()
 	planet.Name = planetRequest.Name
-	planet.Land = planetRequest.Land
 	planet.Weather = planetRequest.Weather
-	planet.AppearanceQuantity = len(planets.Results[0].Films)
+	planet.Land = planetRequest.Land
+	planet.Source = source
+
+	if planet.Name != foundPlanet.Name && source == repository.SourceSwapi {
+		if err = enrich(r.Context(), p.swapiClient, p.timeouts.Swapi, &planet); err != nil {
+			p.respondWithProblem(w, r, err)
+			return
+		}
+	}
+
+	writeCtx, cancelWrite := withTimeout(r.Context(), p.timeouts.Write)
+	defer cancelWrite()
 
-	savedPlanet, err := p.repository.Save(planet)
+	updatedPlanet, err := p.repository.Update(writeCtx, &planet)
 
 	if err != nil {
-		p.log.LogWithFields(r, "error", map[string]interface{}{"err": "error creating planet"}, err.Error())
-		respondWithJson(w, http.StatusInternalServerError, ResponseError{Description: err.Error()})
+		p.respondWithProblem(w, r, fmt.Errorf("error updating planet %s: %w", id.Hex(), conditional(r, err)))
 		return
 	}
 
-	respondWithEmpty(w, http.StatusCreated, "v1/planets/"+savedPlanet.Id.Hex())
+	respondWithTaggedJson(w, r, http.StatusOK, newPlanetResponse(updatedPlanet), planetETag(updatedPlanet))
+}
+
+// removeMatchingPlanet deletes the planet with id if it still has the version named by the If-Match header.
+func (p *PlanetHandler) removeMatchingPlanet(r *http.Request, id primitive.ObjectID) error {
+	readCtx, cancelRead := withTimeout(r.Context(), p.timeouts.Read)
+	defer cancelRead()
+
+	foundPlanet, err := p.repository.FindById(readCtx, id)
+
+	if err != nil {
+		return err
+	}
+
+	if err = checkIfMatch(r, foundPlanet); err != nil {
+		return err
+	}
+
+	writeCtx, cancelWrite := withTimeout(r.Context(), p.timeouts.Write)
+	defer cancelWrite()
+
+	return conditional(r, p.repository.DeleteVersion(writeCtx, id, foundPlanet.Version))
+}
+
+// applyPlanetPatch merges patch over the editable fields of planet.
+func applyPlanetPatch(planet *repository.Planet, patch map[string]interface{}) (PlanetRequest, error) {
+	var planetRequest PlanetRequest
+
+	current, err := json.Marshal(PlanetRequest{Name: planet.Name, Weather: planet.Weather, Land: planet.Land, Source: sourceOf(planet)})
+
+	if err != nil {
+		return planetRequest, err
+	}
+
+	var document interface{}
+
+	if err = json.Unmarshal(current, &document); err != nil {
+		return planetRequest, err
+	}
+
+	patched, err := json.Marshal(mergePatch(document, patch))
+
+	if err != nil {
+		return planetRequest, err
+	}
+
+	err = decodeStrict(bytes.NewReader(patched), &planetRequest)
+
+	return planetRequest, err
+}
+
+// sourceOf returns the source of planet, counting planets stored without one as SWAPI planets.
+func sourceOf(planet *repository.Planet) string {
+	if planet.Source == "" {
+		return repository.SourceSwapi
+	}
+	return planet.Source
+}
+
+// planetLocation is the absolute path of the planet with id.
+func planetLocation(id primitive.ObjectID) string {
+	return "/v1/planets/" + id.Hex()
+}
+
+// prefersMinimal reports whether the request asks, through the Prefer header of RFC 7240, for no body.
+func prefersMinimal(r *http.Request) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			if strings.EqualFold(strings.TrimSpace(strings.SplitN(preference, ";", 2)[0]), "return=minimal") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withTimeout derives a context from parent ending after timeout, or only when parent ends if timeout is zero.
+func withTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout)
 }
 
 func respondWithEmpty(w http.ResponseWriter, code int, location string) {
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", apiContentType)
 	if location != "" {
 		w.Header().Set("Location", location)
 	}
@@ -154,7 +492,7 @@ func respondWithEmpty(w http.ResponseWriter, code int, location string) {
 
 func respondWithJson(w http.ResponseWriter, code int, payload interface{}) {
 	response, _ := json.Marshal(payload)
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", apiContentType)
 
 	w.WriteHeader(code)
 	_, _ = w.Write(response)
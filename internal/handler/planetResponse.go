@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"time"
+)
+
+// apiContentType names version 1 of the public representations below. Fields may be added within a version;
+// renaming or removing one needs a new version.
+const apiContentType = "application/vnd.starwars-planets.v1+json"
+
+// PlanetResponse is the public representation of a planet, kept apart from the stored repository.Planet so the
+// storage model can change without changing the API.
+type PlanetResponse struct {
+	Id                 string             `json:"id"`
+	Name               string             `json:"name"`
+	Weather            string             `json:"weather"`
+	Land               string             `json:"land"`
+	Source             string             `json:"source"`
+	AppearanceQuantity int                `json:"appearanceQuantity"`
+	Swapi              *SwapiDataResponse `json:"swapi,omitempty"`
+	Films              []FilmResponse     `json:"films"`
+	CreatedAt          *time.Time         `json:"createdAt,omitempty"`
+	UpdatedAt          *time.Time         `json:"updatedAt,omitempty"`
+	SyncedAt           *time.Time         `json:"syncedAt,omitempty"`
+}
+
+// SwapiDataResponse is what SWAPI tells about a planet. Numbers SWAPI does not know are null.
+type SwapiDataResponse struct {
+	Url        string   `json:"url"`
+	Diameter   *int64   `json:"diameter"`
+	Gravity    *float64 `json:"gravity"`
+	Population *int64   `json:"population"`
+	Climate    []string `json:"climate"`
+	Terrain    []string `json:"terrain"`
+	Residents  []string `json:"residents"`
+	Films      []string `json:"films"`
+}
+
+type FilmResponse struct {
+	Title       string `json:"title"`
+	EpisodeId   int    `json:"episodeId"`
+	ReleaseDate string `json:"releaseDate"`
+	Url         string `json:"url"`
+}
+
+func newPlanetResponse(planet *repository.Planet) PlanetResponse {
+	response := PlanetResponse{
+		Id:                 planet.Id.Hex(),
+		Name:               planet.Name,
+		Weather:            planet.Weather,
+		Land:               planet.Land,
+		Source:             sourceOf(planet),
+		AppearanceQuantity: planet.AppearanceQuantity,
+		Films:              newFilmResponses(planet.Films),
+		CreatedAt:          planet.CreatedAt,
+		UpdatedAt:          planet.UpdatedAt,
+		SyncedAt:           planet.SyncedAt,
+	}
+
+	if swapi := planet.Swapi; swapi != nil {
+		response.Swapi = &SwapiDataResponse{
+			Url:        swapi.Url,
+			Diameter:   swapi.Diameter,
+			Gravity:    swapi.Gravity,
+			Population: swapi.Population,
+			Climate:    nonNil(swapi.Climate),
+			Terrain:    nonNil(swapi.Terrain),
+			Residents:  nonNil(swapi.Residents),
+			Films:      nonNil(swapi.Films),
+		}
+	}
+
+	return response
+}
+
+func newPlanetResponses(planets []repository.Planet) []PlanetResponse {
+	responses := make([]PlanetResponse, 0, len(planets))
+
+	for i := range planets {
+		responses = append(responses, newPlanetResponse(&planets[i]))
+	}
+
+	return responses
+}
+
+func newFilmResponses(films []repository.Film) []FilmResponse {
+	responses := make([]FilmResponse, 0, len(films))
+
+	for _, film := range films {
+		responses = append(responses, FilmResponse{Title: film.Title, EpisodeId: film.EpisodeId, ReleaseDate: film.ReleaseDate, Url: film.Url})
+	}
+
+	return responses
+}
+
+// nonNil turns missing lists into empty ones, so clients always get an array.
+func nonNil(values []string) []string {
+	if values == nil {
+		return make([]string, 0)
+	}
+	return values
+}
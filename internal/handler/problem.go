@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/client"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "/problems/"
+
+	// statusClientClosedRequest is answered when the client went away before the request finished.
+	statusClientClosedRequest = 499
+)
+
+// Problem is an RFC 7807 problem details document.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+
+	// Candidates holds the SWAPI planet names a caller may pick from when its name did not match exactly one.
+	Candidates []string `json:"candidates,omitempty"`
+}
+
+// badRequestError is raised by the handlers for malformed requests; its message is safe to show to clients.
+type badRequestError struct {
+	detail string
+}
+
+func (e *badRequestError) Error() string {
+	return e.detail
+}
+
+// validationError is raised when a well formed request has invalid fields.
+type validationError struct {
+	fields []FieldError
+}
+
+func (e *validationError) Error() string {
+	return "planet is not valid"
+}
+
+var (
+	errInvalidPlanetId      = &badRequestError{detail: "planet id is not a valid id"}
+	errUnsupportedMediaType = errors.New("request body has an unsupported media type")
+)
+
+// problemFor maps errors from the handlers, the repository and the SWAPI client to the problem sent to clients.
+// Unknown errors become a 500 without details, so internal messages never leak.
+func problemFor(err error) Problem {
+	var badRequest *badRequestError
+	var validation *validationError
+	var match *client.MatchError
+	var upstream *client.UpstreamError
+
+	switch {
+	case errors.As(err, &badRequest):
+		return Problem{Type: problemTypePrefix + "invalid-request", Title: "Invalid request", Status: http.StatusBadRequest,
+			Detail: badRequest.detail}
+	case errors.Is(err, errUnsupportedMediaType):
+		return Problem{Type: problemTypePrefix + "unsupported-media-type", Title: "Unsupported media type",
+			Status: http.StatusUnsupportedMediaType, Detail: "planet patches must be sent as " + mergePatchContentType}
+	case errors.As(err, &validation):
+		return Problem{Type: problemTypePrefix + "invalid-planet", Title: "Invalid planet", Status: http.StatusUnprocessableEntity,
+			Detail: "one or more fields are not valid", Errors: validation.fields}
+	case errors.Is(err, repository.ErrNotFound):
+		return Problem{Type: problemTypePrefix + "planet-not-found", Title: "Planet not found", Status: http.StatusNotFound,
+			Detail: "there is no planet with the requested id"}
+	case errors.Is(err, client.ErrPlanetNotFound):
+		problem := Problem{Type: problemTypePrefix + "swapi-planet-not-found", Title: "Planet not found in SWAPI", Status: http.StatusNotFound,
+			Detail: "no SWAPI planet has this name, register it with source custom to add an original planet"}
+		if errors.As(err, &match) {
+			problem.Candidates = match.Candidates
+		}
+		return problem
+	case errors.Is(err, client.ErrAmbiguousPlanet):
+		problem := Problem{Type: problemTypePrefix + "ambiguous-swapi-planet", Title: "Several planets match in SWAPI", Status: http.StatusConflict,
+			Detail: "more than one SWAPI planet has this name, pick one of the candidates"}
+		if errors.As(err, &match) {
+			problem.Candidates = match.Candidates
+		}
+		return problem
+	case errors.Is(err, errPreconditionFailed):
+		return Problem{Type: problemTypePrefix + "precondition-failed", Title: "Precondition failed", Status: http.StatusPreconditionFailed,
+			Detail: "the planet does not match If-Match, fetch it again and retry"}
+	case errors.Is(err, repository.ErrVersionConflict):
+		return Problem{Type: problemTypePrefix + "planet-changed", Title: "Planet changed", Status: http.StatusConflict,
+			Detail: "the planet was changed by another request, fetch it again and retry"}
+	case errors.Is(err, errIdempotentRequestInProgress):
+		return Problem{Type: problemTypePrefix + "request-in-progress", Title: "Request in progress", Status: http.StatusConflict,
+			Detail: "a request with this Idempotency-Key is still running, retry once it finishes"}
+	case errors.Is(err, errIdempotencyKeyReused):
+		return Problem{Type: problemTypePrefix + "idempotency-key-reused", Title: "Idempotency key reused", Status: http.StatusUnprocessableEntity,
+			Detail: "this Idempotency-Key was already used with a different request"}
+	case errors.Is(err, repository.ErrDuplicate):
+		return Problem{Type: problemTypePrefix + "duplicate-planet", Title: "Planet already exists", Status: http.StatusConflict,
+			Detail: "another planet already has this name"}
+	case errors.Is(err, client.ErrCircuitOpen):
+		return Problem{Type: problemTypePrefix + "swapi-unavailable", Title: "SWAPI unavailable", Status: http.StatusServiceUnavailable,
+			Detail: "SWAPI keeps failing, so planets cannot be looked up for now, retry later"}
+	case errors.As(err, &upstream):
+		return Problem{Type: problemTypePrefix + "swapi-error", Title: "SWAPI error", Status: http.StatusBadGateway,
+			Detail: "SWAPI could not answer the lookup"}
+	case errors.Is(err, context.DeadlineExceeded):
+		return Problem{Type: problemTypePrefix + "timeout", Title: "Request timed out", Status: http.StatusGatewayTimeout,
+			Detail: "the request took longer than allowed"}
+	case errors.Is(err, context.Canceled):
+		return Problem{Type: problemTypePrefix + "request-canceled", Title: "Request canceled", Status: statusClientClosedRequest,
+			Detail: "the request was canceled by the client"}
+	default:
+		return Problem{Type: problemTypePrefix + "internal-error", Title: "Internal server error", Status: http.StatusInternalServerError,
+			Detail: "an unexpected error occurred"}
+	}
+}
+
+// respondWithProblem logs err and writes the matching problem document, identified by the request id.
+func (p *PlanetHandler) respondWithProblem(w http.ResponseWriter, r *http.Request, err error) {
+	problem := problemFor(err)
+	problem.Instance = requestId(r)
+
+	level := "info"
+	if problem.Status >= http.StatusInternalServerError {
+		level = "error"
+	}
+
+	p.log.LogWithFields(r, level, map[string]interface{}{"status": problem.Status, "type": problem.Type}, err.Error())
+
+	var duplicate *repository.DuplicateError
+	if errors.As(err, &duplicate) {
+		w.Header().Set("Location", planetLocation(duplicate.Id))
+	}
+
+	var circuitOpen *client.CircuitOpenError
+	if errors.As(err, &circuitOpen) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(circuitOpen.RetryAfter.Seconds()))))
+	}
+
+	response, _ := json.Marshal(problem)
+	w.Header().Set("Content-Type", problemContentType)
+
+	w.WriteHeader(problem.Status)
+	_, _ = w.Write(response)
+}
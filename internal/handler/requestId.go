@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+const requestIdHeader = "X-Request-Id"
+
+// RequestId makes sure every request carries an X-Request-Id, generating one when the client did not send it,
+// and echoes it in the response.
+func RequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIdHeader)
+
+		if id == "" {
+			id = primitive.NewObjectID().Hex()
+			r.Header.Set(requestIdHeader, id)
+		}
+
+		w.Header().Set(requestIdHeader, id)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func requestId(r *http.Request) string {
+	return r.Header.Get(requestIdHeader)
+}
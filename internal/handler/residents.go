@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/client"
+)
+
+// Resident is a SWAPI person living on a planet. Species and Homeworld are SWAPI urls.
+type Resident struct {
+	Name      string   `json:"name"`
+	BirthYear string   `json:"birthYear"`
+	Species   []string `json:"species"`
+	Homeworld string   `json:"homeworld"`
+	Url       string   `json:"url"`
+}
+
+// resolveResidents looks up the people at urls, within the SWAPI deadline.
+func (p *PlanetHandler) resolveResidents(ctx context.Context, urls []string) ([]Resident, error) {
+	ctx, cancel := withTimeout(ctx, p.timeouts.Swapi)
+	defer cancel()
+
+	people, err := p.swapiClient.GetPeople(ctx, urls)
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting residents from swapi: %w", err)
+	}
+
+	residents := make([]Resident, 0, len(people))
+
+	for _, person := range people {
+		residents = append(residents, residentOf(person))
+	}
+
+	return residents, nil
+}
+
+func residentOf(person client.SwapiPerson) Resident {
+	species := person.Species
+	if species == nil {
+		species = make([]string, 0)
+	}
+
+	return Resident{Name: person.Name, BirthYear: person.BirthYear, Species: species, Homeworld: person.Homeworld, Url: person.Url}
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/client"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/logger"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// SyncStatus describes the running or last finished sync. Checked counts the planets looked up in SWAPI, Updated
+// those whose SWAPI data changed and Failed those that could not be synced.
+type SyncStatus struct {
+	Running    bool       `json:"running"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Checked    int        `json:"checked"`
+	Updated    int        `json:"updated"`
+	Failed     int        `json:"failed"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Syncer refreshes the SWAPI data stored on planets, walking the SWAPI planets in batches ordered by id. Planets
+// SWAPI no longer knows keep their data and count as failed.
+type Syncer struct {
+	swapiClient client.SwapiClientInterface
+	repository  repository.PlanetRepositoryInterface
+	log         logger.Interface
+	timeouts    config.TimeoutConfig
+	config      config.SyncConfig
+	trigger     chan struct{}
+	mutex       sync.Mutex
+	status      SyncStatus
+}
+
+func NewSyncer(repository repository.PlanetRepositoryInterface,
+	swapiClient client.SwapiClientInterface,
+	logger logger.Interface,
+	timeouts config.TimeoutConfig,
+	config config.SyncConfig) *Syncer {
+
+	syncer := new(Syncer)
+
+	syncer.swapiClient = swapiClient
+	syncer.repository = repository
+	syncer.log = logger
+	syncer.timeouts = timeouts
+	syncer.config = config
+	syncer.trigger = make(chan struct{}, 1)
+
+	return syncer
+}
+
+// Run syncs every configured interval and whenever a sync is triggered, until ctx ends.
+func (s *Syncer) Run(ctx context.Context) {
+	var tick <-chan time.Time
+
+	if s.config.Interval > 0 {
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case <-s.trigger:
+		}
+
+		s.Sync(ctx)
+	}
+}
+
+// Trigger asks Run for a sync. A trigger arriving while another one is pending is dropped.
+func (s *Syncer) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Sync refreshes every stored planet from SWAPI, unless a sync is already running.
+func (s *Syncer) Sync(ctx context.Context) {
+	if !s.start() {
+		return
+	}
+
+	batchSize := s.config.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	after := ""
+
+	for {
+		if err := ctx.Err(); err != nil {
+			s.finish(err)
+			return
+		}
+
+		readCtx, cancel := withTimeout(ctx, s.timeouts.Read)
+		planets, err := s.repository.FindAll(readCtx, repository.Filter{Source: repository.SourceSwapi, Limit: int64(batchSize),
+			After: after})
+		cancel()
+
+		if err != nil {
+			s.finish(fmt.Errorf("error finding planets to sync: %w", err))
+			return
+		}
+
+		for _, planet := range *planets {
+			s.syncPlanet(ctx, planet)
+		}
+
+		if len(*planets) < batchSize {
+			s.finish(nil)
+			return
+		}
+
+		after = (*planets)[len(*planets)-1].Id.Hex()
+	}
+}
+
+// Status returns a copy of the current status.
+func (s *Syncer) Status() SyncStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.status
+}
+
+func (s *Syncer) TriggerSync(w http.ResponseWriter, r *http.Request) {
+	s.Trigger()
+
+	respondWithJson(w, http.StatusAccepted, s.Status())
+}
+
+func (s *Syncer) GetSyncStatus(w http.ResponseWriter, r *http.Request) {
+	respondWithJson(w, http.StatusOK, s.Status())
+}
+
+// syncPlanet refreshes planet from SWAPI. A planet whose SWAPI data did not change is only marked as synced, so
+// its version and ETag stay the same.
+func (s *Syncer) syncPlanet(ctx context.Context, planet repository.Planet) {
+	synced := planet
+
+	err := enrich(ctx, s.swapiClient, s.timeouts.Swapi, &synced)
+	changed := !reflect.DeepEqual(syncedFields(planet), syncedFields(synced))
+
+	if err == nil {
+		writeCtx, cancel := withTimeout(ctx, s.timeouts.Write)
+
+		if changed {
+			_, err = s.repository.Update(writeCtx, &synced)
+		} else {
+			err = s.repository.MarkSynced(writeCtx, planet.Id, *synced.SyncedAt)
+		}
+
+		cancel()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status.Checked++
+
+	if err != nil {
+		s.status.Failed++
+		s.log.LogWithFields(nil, "warn", map[string]interface{}{"planet": planet.Id.Hex(), "err": err.Error()}, "error syncing planet")
+		return
+	}
+
+	if changed {
+		s.status.Updated++
+	}
+}
+
+func (s *Syncer) start() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.status.Running {
+		return false
+	}
+
+	startedAt := time.Now().UTC()
+	s.status = SyncStatus{Running: true, StartedAt: &startedAt}
+
+	return true
+}
+
+func (s *Syncer) finish(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	finishedAt := time.Now().UTC()
+	s.status.Running = false
+	s.status.FinishedAt = &finishedAt
+
+	level := "info"
+	if err != nil {
+		s.status.Error = err.Error()
+		level = "error"
+	}
+
+	s.log.LogWithFields(nil, level, map[string]interface{}{
+		"checked": s.status.Checked, "updated": s.status.Updated, "failed": s.status.Failed,
+	}, "swapi sync finished")
+}
+
+// syncedFields keeps the fields of planet copied from SWAPI, with empty lists set to nil since repositories may
+// read them back either way.
+func syncedFields(planet repository.Planet) repository.Planet {
+	fields := repository.Planet{AppearanceQuantity: planet.AppearanceQuantity}
+
+	if len(planet.Films) > 0 {
+		fields.Films = planet.Films
+	}
+
+	if planet.Swapi != nil {
+		swapi := *planet.Swapi
+
+		for _, list := range []*[]string{&swapi.Climate, &swapi.Terrain, &swapi.Residents, &swapi.Films} {
+			if len(*list) == 0 {
+				*list = nil
+			}
+		}
+
+		fields.Swapi = &swapi
+	}
+
+	return fields
+}
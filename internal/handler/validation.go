@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"io"
+	"net/http"
+	"regexp"
+	"unicode/utf8"
+)
+
+const (
+	maxBodyBytes         = 1 << 14
+	maxPlanetFieldLength = 100
+)
+
+var (
+	planetNamePattern = regexp.MustCompile(`^[\p{L}\p{N}]([\p{L}\p{N} '\-]*[\p{L}\p{N}])?$`)
+	planetTextPattern = regexp.MustCompile(`^[\p{L}\p{N} ,'\-]*$`)
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validate returns one FieldError per invalid field of the request, or nil when it is valid.
+func (p PlanetRequest) Validate() []FieldError {
+	var fieldErrors []FieldError
+
+	if p.Name == "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "name", Message: "is required"})
+	}
+
+	switch p.Source {
+	case "", repository.SourceSwapi:
+	case repository.SourceCustom:
+		// Custom planets have no SWAPI data, so they must describe themselves.
+		if p.Weather == "" {
+			fieldErrors = append(fieldErrors, FieldError{Field: "weather", Message: "is required for custom planets"})
+		}
+		if p.Land == "" {
+			fieldErrors = append(fieldErrors, FieldError{Field: "land", Message: "is required for custom planets"})
+		}
+	default:
+		fieldErrors = append(fieldErrors, FieldError{Field: "source", Message: "must be swapi or custom"})
+	}
+
+	for _, field := range []struct {
+		name    string
+		value   string
+		pattern *regexp.Regexp
+	}{
+		{"name", p.Name, planetNamePattern},
+		{"weather", p.Weather, planetTextPattern},
+		{"land", p.Land, planetTextPattern},
+	} {
+		if field.value == "" {
+			continue
+		}
+
+		if utf8.RuneCountInString(field.value) > maxPlanetFieldLength {
+			fieldErrors = append(fieldErrors, FieldError{Field: field.name, Message: "must have at most 100 characters"})
+		} else if !field.pattern.MatchString(field.value) {
+			fieldErrors = append(fieldErrors, FieldError{Field: field.name, Message: "contains invalid characters"})
+		}
+	}
+
+	return fieldErrors
+}
+
+// decodeBody decodes a single JSON value from the request body into dst, rejecting unknown fields,
+// trailing data and bodies larger than maxBodyBytes.
+func decodeBody(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	return decodeStrict(http.MaxBytesReader(w, r.Body, maxBodyBytes), dst)
+}
+
+func decodeStrict(body io.Reader, dst interface{}) error {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		return err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("request body must contain a single JSON value")
+	}
+
+	return nil
+}
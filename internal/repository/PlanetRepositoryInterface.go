@@ -1,6 +1,40 @@
 package repository
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ErrNotFound is returned when no planet matches the requested id.
+var ErrNotFound = errors.New("planet not found")
+
+// ErrDuplicate is returned when another planet already has the same name, ignoring case.
+var ErrDuplicate = errors.New("planet already exists")
+
+// ErrVersionConflict is returned when a planet changed since the version being written or deleted was read.
+var ErrVersionConflict = errors.New("planet was changed by another request")
+
+// DuplicateError wraps ErrDuplicate with the id of the planet already holding the name.
+type DuplicateError struct {
+	Id primitive.ObjectID
+}
+
+func (e *DuplicateError) Error() string {
+	return ErrDuplicate.Error()
+}
+
+func (e *DuplicateError) Unwrap() error {
+	return ErrDuplicate
+}
+
+// Sources of a planet. SWAPI planets are looked up in SWAPI when registered, custom ones are not. Planets stored
+// before sources were recorded have an empty Source and come from SWAPI.
+const (
+	SourceSwapi  = "swapi"
+	SourceCustom = "custom"
+)
 
 type Planet struct {
 	Id                 primitive.ObjectID `json:"-" bson:"_id"`
@@ -8,11 +42,86 @@ type Planet struct {
 	Weather            string             `bson:"weather"`
 	Land               string             `bson:"land"`
 	AppearanceQuantity int                `bson:"appearanceQuantity"`
+	Source             string             `bson:"source"`
+	Swapi              *SwapiData         `bson:"swapi,omitempty"`
+	Films              []Film             `bson:"films,omitempty"`
+
+	// SyncedAt is when the SWAPI data of the planet was last copied. CreatedAt and UpdatedAt are stamped by the
+	// repositories on Save and Update; planets stored before they were recorded have none.
+	SyncedAt  *time.Time `bson:"syncedAt,omitempty"`
+	CreatedAt *time.Time `bson:"createdAt,omitempty"`
+	UpdatedAt *time.Time `bson:"updatedAt,omitempty"`
+
+	// Version counts the revisions of the planet, starting at 1. Planets stored before versions were recorded
+	// have version 0 until their next update.
+	Version int64 `bson:"version"`
 }
 
+// Film is a film the planet appears in, copied from SWAPI so it can be shown without calling SWAPI. The json
+// tags of Film and SwapiData name the documents the SQL repository stores, not the API fields.
+type Film struct {
+	Title       string `json:"title" bson:"title"`
+	EpisodeId   int    `json:"episodeId" bson:"episodeId"`
+	ReleaseDate string `json:"releaseDate" bson:"releaseDate"`
+	Url         string `json:"url" bson:"url"`
+}
+
+// SwapiData is what SWAPI tells about a planet. Numbers SWAPI reports as "unknown" are nil, gravity is in
+// standard units, and climate and terrain are split into their comma separated values.
+type SwapiData struct {
+	Url        string   `json:"url" bson:"url"`
+	Diameter   *int64   `json:"diameter" bson:"diameter"`
+	Gravity    *float64 `json:"gravity" bson:"gravity"`
+	Population *int64   `json:"population" bson:"population"`
+	Climate    []string `json:"climate" bson:"climate"`
+	Terrain    []string `json:"terrain" bson:"terrain"`
+	Residents  []string `json:"residents" bson:"residents"`
+	Films      []string `json:"films" bson:"films"`
+}
+
+// stamp records a new revision of planet: the next version, and the current time as its update time, and as its
+// creation time too when created is set. Times are truncated to milliseconds, the precision Mongo keeps.
+func stamp(planet *Planet, created bool) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	if created {
+		planet.CreatedAt = &now
+		planet.Version = 0
+	}
+
+	planet.UpdatedAt = &now
+	planet.Version++
+}
+
+// errorsForAll returns err as the error of each of n planets written together.
+func errorsForAll(n int, err error) []error {
+	errs := make([]error, n)
+
+	for i := range errs {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// PlanetRepositoryInterface stores planets. Update writes a planet only while the stored version still is the
+// Version of the given planet, and DeleteVersion deletes one only while it has version, both returning
+// ErrVersionConflict otherwise. MarkSynced records when the SWAPI data of a planet was last checked, leaving its
+// version and update time alone since the planet itself did not change.
+//
+// InsertMany saves planets like Save, returning the error of each planet in order, nil for those stored; one
+// failing does not stop the others. DeleteMany removes the planets matching the filter, ignoring its sort and
+// pagination, and returns how many it removed.
 type PlanetRepositoryInterface interface {
-	FindById(id primitive.ObjectID) (*Planet, error)
-	Save(planet *Planet) (*Planet, error)
-	FindAll(filter Filter) (*[]Planet, error)
-	Delete(id primitive.ObjectID) error
-}
\ No newline at end of file
+	FindById(ctx context.Context, id primitive.ObjectID) (*Planet, error)
+	Save(ctx context.Context, planet *Planet) (*Planet, error)
+	Update(ctx context.Context, planet *Planet) (*Planet, error)
+	FindAll(ctx context.Context, filter Filter) (*[]Planet, error)
+	Count(ctx context.Context, filter Filter) (int64, error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	DeleteVersion(ctx context.Context, id primitive.ObjectID, version int64) error
+	MarkSynced(ctx context.Context, id primitive.ObjectID, syncedAt time.Time) error
+	InsertMany(ctx context.Context, planets []*Planet) []error
+	DeleteMany(ctx context.Context, filter Filter) (int64, error)
+	IdempotencyRepositoryInterface
+}
@@ -0,0 +1,79 @@
+package repository
+
+import "strings"
+
+// sortFields maps the sort keys accepted by the API to the stored field names.
+var sortFields = map[string]string{
+	"name":               "name",
+	"appearanceQuantity": "appearanceQuantity",
+}
+
+type Filter struct {
+	Name string `schema:"name"`
+
+	// NamePrefix and NameContains match the planet name ignoring case.
+	NamePrefix   string `schema:"name[prefix]"`
+	NameContains string `schema:"name[contains]"`
+
+	// Weather and Land match any of the listed values ignoring case.
+	Weather []string `schema:"weather"`
+	Land    []string `schema:"land"`
+
+	AppearanceQuantityGt  *int `schema:"appearanceQuantity[gt]"`
+	AppearanceQuantityGte *int `schema:"appearanceQuantity[gte]"`
+	AppearanceQuantityLt  *int `schema:"appearanceQuantity[lt]"`
+	AppearanceQuantityLte *int `schema:"appearanceQuantity[lte]"`
+
+	// Climate and Terrain match planets with any of the listed SWAPI values ignoring case. The SWAPI bounds
+	// leave out planets whose value is unknown.
+	Climate       []string `schema:"climate"`
+	Terrain       []string `schema:"terrain"`
+	DiameterGte   *int64   `schema:"diameter[gte]"`
+	DiameterLte   *int64   `schema:"diameter[lte]"`
+	PopulationGte *int64   `schema:"population[gte]"`
+	PopulationLte *int64   `schema:"population[lte]"`
+
+	// Film matches planets appearing in any of the listed film titles, ignoring case.
+	Film []string `schema:"film"`
+
+	// MinResidents matches planets with at least that many SWAPI residents.
+	MinResidents *int `schema:"minResidents"`
+
+	// Source is SourceSwapi or SourceCustom to list only the planets of that source.
+	Source string `schema:"source"`
+
+	// Sort is one of the sortFields keys, prefixed with "-" for descending order.
+	Sort   string `schema:"sort"`
+	Limit  int64  `schema:"limit"`
+	Offset int64  `schema:"offset"`
+
+	// After and Before are planet ids used for keyset pagination on _id.
+	After  string `schema:"after"`
+	Before string `schema:"before"`
+}
+
+// ValidSort reports whether sort is empty or a known sort key.
+func ValidSort(sort string) bool {
+	_, ok := sortFields[strings.TrimPrefix(sort, "-")]
+	return sort == "" || ok
+}
+
+// SortOrder returns the stored field and direction (1 or -1) used to order results, defaulting to _id ascending.
+func (f Filter) SortOrder() (string, int) {
+	field, ok := sortFields[strings.TrimPrefix(f.Sort, "-")]
+
+	if !ok {
+		return "_id", 1
+	}
+
+	if strings.HasPrefix(f.Sort, "-") {
+		return field, -1
+	}
+
+	return field, 1
+}
+
+// Keyset reports whether the filter paginates with the _id cursor instead of an offset.
+func (f Filter) Keyset() bool {
+	return f.Sort == "" && f.Offset == 0
+}
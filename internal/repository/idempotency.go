@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrIdempotencyKeyNotFound is returned when no unexpired record has the requested key.
+var ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+
+// ErrIdempotencyKeyExists is returned when saving a record whose key an unexpired record already has.
+var ErrIdempotencyKeyExists = errors.New("idempotency key already exists")
+
+// IdempotencyRecord is the response given to the first request carrying an Idempotency-Key, kept until ExpiresAt
+// so retries can be answered with it. RequestHash identifies the request the response belongs to. A record with
+// no Status is pending: it reserves the key while the first request runs.
+type IdempotencyRecord struct {
+	Key         string            `bson:"_id"`
+	RequestHash string            `bson:"requestHash"`
+	Status      int               `bson:"status"`
+	Header      map[string]string `bson:"header"`
+	Body        []byte            `bson:"body"`
+	ExpiresAt   time.Time         `bson:"expiresAt"`
+}
+
+type IdempotencyRepositoryInterface interface {
+	FindIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error)
+	SaveIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error
+	ReplaceIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error
+	DeleteIdempotencyRecord(ctx context.Context, key string) error
+}
+
+// Pending reports whether record only reserves its key.
+func (r *IdempotencyRecord) Pending() bool {
+	return r.Status == 0
+}
+
+func expired(record *IdempotencyRecord, now time.Time) bool {
+	return !record.ExpiresAt.After(now)
+}
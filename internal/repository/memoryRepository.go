@@ -0,0 +1,523 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is a concurrency-safe PlanetRepositoryInterface kept in process memory, meant for local runs and tests.
+type Memory struct {
+	mutex   sync.RWMutex
+	planets map[primitive.ObjectID]Planet
+	records map[string]IdempotencyRecord
+}
+
+func NewMemory() *Memory {
+	m := new(Memory)
+	m.planets = make(map[primitive.ObjectID]Planet)
+	m.records = make(map[string]IdempotencyRecord)
+	return m
+}
+
+func (m *Memory) Save(ctx context.Context, planet *Planet) (*Planet, error) {
+	if err := ctx.Err(); err != nil {
+		return planet, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if planet.Id.IsZero() {
+		planet.Id = primitive.NewObjectID()
+	}
+
+	if _, ok := m.planets[planet.Id]; ok {
+		return planet, errors.New("planet id " + planet.Id.Hex() + " already exists")
+	}
+
+	if err := m.duplicateError(planet); err != nil {
+		return planet, err
+	}
+
+	stamp(planet, true)
+
+	m.planets[planet.Id] = clone(*planet)
+
+	return planet, nil
+}
+
+func (m *Memory) Update(ctx context.Context, planet *Planet) (*Planet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.planets[planet.Id]
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if stored.Version != planet.Version {
+		return nil, ErrVersionConflict
+	}
+
+	if err := m.duplicateError(planet); err != nil {
+		return nil, err
+	}
+
+	stamp(planet, false)
+
+	m.planets[planet.Id] = clone(*planet)
+
+	return planet, nil
+}
+
+func (m *Memory) FindAll(ctx context.Context, filter Filter) (*[]Planet, error) {
+	planets, err := m.matching(ctx, filter)
+
+	if err != nil {
+		return &planets, err
+	}
+
+	field, direction := filter.SortOrder()
+
+	if filter.Before != "" {
+		direction = -1
+	}
+
+	sort.SliceStable(planets, func(i, j int) bool {
+		c := compare(planets[i], planets[j], field)
+		if c == 0 {
+			c = compare(planets[i], planets[j], "_id")
+		}
+		return c*direction < 0
+	})
+
+	if filter.Offset > 0 {
+		if filter.Offset >= int64(len(planets)) {
+			planets = planets[:0]
+		} else {
+			planets = planets[filter.Offset:]
+		}
+	}
+
+	if filter.Limit > 0 && filter.Limit < int64(len(planets)) {
+		planets = planets[:filter.Limit]
+	}
+
+	if filter.Before != "" {
+		reverse(planets)
+	}
+
+	return &planets, nil
+}
+
+func (m *Memory) Count(ctx context.Context, filter Filter) (int64, error) {
+	filter.After, filter.Before = "", ""
+
+	planets, err := m.matching(ctx, filter)
+
+	return int64(len(planets)), err
+}
+
+func (m *Memory) FindById(ctx context.Context, id primitive.ObjectID) (*Planet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	planet, ok := m.planets[id]
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	planet = clone(planet)
+
+	return &planet, nil
+}
+
+func (m *Memory) InsertMany(ctx context.Context, planets []*Planet) []error {
+	errs := make([]error, len(planets))
+
+	for i, planet := range planets {
+		_, errs[i] = m.Save(ctx, planet)
+	}
+
+	return errs
+}
+
+func (m *Memory) DeleteMany(ctx context.Context, filter Filter) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var deleted int64
+
+	for id, planet := range m.planets {
+		if matches(filter, planet) {
+			delete(m.planets, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, id primitive.ObjectID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.planets[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(m.planets, id)
+
+	return nil
+}
+
+func (m *Memory) DeleteVersion(ctx context.Context, id primitive.ObjectID, version int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.planets[id]
+
+	if !ok {
+		return ErrNotFound
+	}
+
+	if stored.Version != version {
+		return ErrVersionConflict
+	}
+
+	delete(m.planets, id)
+
+	return nil
+}
+
+func (m *Memory) MarkSynced(ctx context.Context, id primitive.ObjectID, syncedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.planets[id]
+
+	if !ok {
+		return ErrNotFound
+	}
+
+	stored.SyncedAt = &syncedAt
+	m.planets[id] = stored
+
+	return nil
+}
+
+func (m *Memory) FindIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	record, ok := m.records[key]
+
+	if !ok || expired(&record, time.Now()) {
+		return nil, ErrIdempotencyKeyNotFound
+	}
+
+	record = cloneRecord(record)
+	return &record, nil
+}
+
+func (m *Memory) SaveIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+
+	for key, stored := range m.records {
+		if expired(&stored, now) {
+			delete(m.records, key)
+		}
+	}
+
+	if _, ok := m.records[record.Key]; ok {
+		return ErrIdempotencyKeyExists
+	}
+
+	m.records[record.Key] = cloneRecord(*record)
+
+	return nil
+}
+
+func (m *Memory) ReplaceIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.records[record.Key]; !ok {
+		return ErrIdempotencyKeyNotFound
+	}
+
+	m.records[record.Key] = cloneRecord(*record)
+
+	return nil
+}
+
+func (m *Memory) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.records, key)
+
+	return nil
+}
+
+// duplicateError returns a DuplicateError when another planet has the name of planet; callers must hold the lock.
+func (m *Memory) duplicateError(planet *Planet) error {
+	for id, existing := range m.planets {
+		if id != planet.Id && strings.EqualFold(existing.Name, planet.Name) {
+			return &DuplicateError{Id: id}
+		}
+	}
+	return nil
+}
+
+// matching returns a copy of the planets accepted by filter, applying the same rules as mountFilter
+// plus the keyset cursor.
+func (m *Memory) matching(ctx context.Context, filter Filter) ([]Planet, error) {
+	planets := make([]Planet, 0)
+
+	if err := ctx.Err(); err != nil {
+		return planets, err
+	}
+
+	var after, before primitive.ObjectID
+	var err error
+
+	if filter.After != "" {
+		if after, err = primitive.ObjectIDFromHex(filter.After); err != nil {
+			return planets, err
+		}
+	}
+
+	if filter.Before != "" {
+		if before, err = primitive.ObjectIDFromHex(filter.Before); err != nil {
+			return planets, err
+		}
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, planet := range m.planets {
+		if filter.After != "" && bytes.Compare(planet.Id[:], after[:]) <= 0 {
+			continue
+		}
+
+		if filter.Before != "" && bytes.Compare(planet.Id[:], before[:]) >= 0 {
+			continue
+		}
+
+		if matches(filter, planet) {
+			planets = append(planets, clone(planet))
+		}
+	}
+
+	return planets, nil
+}
+
+func matches(filter Filter, planet Planet) bool {
+	name := strings.ToLower(planet.Name)
+
+	if filter.Name != "" && planet.Name != filter.Name {
+		return false
+	}
+
+	if filter.NamePrefix != "" && !strings.HasPrefix(name, strings.ToLower(filter.NamePrefix)) {
+		return false
+	}
+
+	if filter.NameContains != "" && !strings.Contains(name, strings.ToLower(filter.NameContains)) {
+		return false
+	}
+
+	if len(filter.Weather) > 0 && !equalsAny(planet.Weather, filter.Weather) {
+		return false
+	}
+
+	if len(filter.Land) > 0 && !equalsAny(planet.Land, filter.Land) {
+		return false
+	}
+
+	if filter.Source != "" && (planet.Source == SourceCustom) != (filter.Source == SourceCustom) {
+		return false
+	}
+
+	quantity := planet.AppearanceQuantity
+
+	if !((filter.AppearanceQuantityGt == nil || quantity > *filter.AppearanceQuantityGt) &&
+		(filter.AppearanceQuantityGte == nil || quantity >= *filter.AppearanceQuantityGte) &&
+		(filter.AppearanceQuantityLt == nil || quantity < *filter.AppearanceQuantityLt) &&
+		(filter.AppearanceQuantityLte == nil || quantity <= *filter.AppearanceQuantityLte)) {
+		return false
+	}
+
+	if len(filter.Film) > 0 && !appearsInAny(planet.Films, filter.Film) {
+		return false
+	}
+
+	return matchesSwapi(filter, planet.Swapi)
+}
+
+func appearsInAny(films []Film, titles []string) bool {
+	for _, film := range films {
+		if equalsAny(film.Title, titles) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesSwapi(filter Filter, swapi *SwapiData) bool {
+	if swapi == nil {
+		swapi = new(SwapiData)
+	}
+
+	if len(filter.Climate) > 0 && !anyEqualsAny(swapi.Climate, filter.Climate) {
+		return false
+	}
+
+	if len(filter.Terrain) > 0 && !anyEqualsAny(swapi.Terrain, filter.Terrain) {
+		return false
+	}
+
+	if filter.MinResidents != nil && len(swapi.Residents) < *filter.MinResidents {
+		return false
+	}
+
+	return within(swapi.Diameter, filter.DiameterGte, filter.DiameterLte) &&
+		within(swapi.Population, filter.PopulationGte, filter.PopulationLte)
+}
+
+// within reports whether value is known and inside the bounds that are set.
+func within(value *int64, gte *int64, lte *int64) bool {
+	if gte == nil && lte == nil {
+		return true
+	}
+
+	return value != nil && (gte == nil || *value >= *gte) && (lte == nil || *value <= *lte)
+}
+
+func anyEqualsAny(values []string, wanted []string) bool {
+	for _, value := range values {
+		if equalsAny(value, wanted) {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneRecord(record IdempotencyRecord) IdempotencyRecord {
+	header := make(map[string]string, len(record.Header))
+	for name, value := range record.Header {
+		header[name] = value
+	}
+
+	record.Header = header
+	record.Body = append([]byte(nil), record.Body...)
+
+	return record
+}
+
+// clone copies planet, so callers never share the SWAPI data, films and times held by the repository.
+func clone(planet Planet) Planet {
+	if planet.Films != nil {
+		planet.Films = append([]Film{}, planet.Films...)
+	}
+
+	planet.SyncedAt = cloneTime(planet.SyncedAt)
+	planet.CreatedAt = cloneTime(planet.CreatedAt)
+	planet.UpdatedAt = cloneTime(planet.UpdatedAt)
+
+	if planet.Swapi == nil {
+		return planet
+	}
+
+	swapi := *planet.Swapi
+	swapi.Climate = append([]string(nil), swapi.Climate...)
+	swapi.Terrain = append([]string(nil), swapi.Terrain...)
+	swapi.Residents = append([]string(nil), swapi.Residents...)
+	swapi.Films = append([]string(nil), swapi.Films...)
+	planet.Swapi = &swapi
+
+	return planet
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	copied := *t
+	return &copied
+}
+
+func equalsAny(value string, values []string) bool {
+	for _, v := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare orders two planets by the stored field name, as returned by Filter.SortOrder.
+func compare(a Planet, b Planet, field string) int {
+	switch field {
+	case "name":
+		return strings.Compare(a.Name, b.Name)
+	case "appearanceQuantity":
+		return a.AppearanceQuantity - b.AppearanceQuantity
+	default:
+		return bytes.Compare(a.Id[:], b.Id[:])
+	}
+}
@@ -2,25 +2,29 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
+	"regexp"
+	"strconv"
+	"time"
 )
 
 type sessionCreator struct {
 	Client *mongo.Client
 }
 
-type Mongo struct {
-	collection *mongo.Collection
-	session *mongo.Client
-}
+// nameCollation compares names ignoring case, matching the unique name index.
+var nameCollation = &options.Collation{Locale: "en", Strength: 2}
 
-type Filter struct {
-	Name     string `schema:"name"`
+type Mongo struct {
+	collection  *mongo.Collection
+	idempotency *mongo.Collection
+	session     *mongo.Client
 }
 
 func NewSession(config config.MongoConfig) *Mongo {
@@ -49,62 +53,447 @@ func NewSession(config config.MongoConfig) *Mongo {
 
 	mo.getCollection(config)
 
+	if err = mo.createIndexes(ctx); err != nil {
+		log.Print("Error on creating indexes ", err)
+	}
+
 	return mo
 }
 
+// createIndexes makes planet names unique ignoring case, using the nameCollation, and lets Mongo remove expired
+// idempotency records.
+func (m *Mongo) createIndexes(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetName("name_unique").SetUnique(true).SetCollation(nameCollation),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = m.idempotency.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+	})
+
+	return err
+}
+
 func (m *Mongo) getCollection(config config.MongoConfig) {
 	c := m.session.Database(config.Database).Collection(config.Database)
 	m.collection = c
+	m.idempotency = m.session.Database(config.Database).Collection("idempotencyKeys")
 }
 
-func (m *Mongo) Save(planet *Planet) (*Planet, error) {
-	_, err := m.collection.InsertOne(context.TODO(), &planet)
+func (m *Mongo) Save(ctx context.Context, planet *Planet) (*Planet, error) {
+	if planet.Id.IsZero() {
+		planet.Id = primitive.NewObjectID()
+	}
+
+	stamp(planet, true)
+
+	_, err := m.collection.InsertOne(ctx, &planet)
+
+	if isDuplicateKey(err) {
+		return planet, m.duplicateError(ctx, planet, err)
+	}
 
 	return planet, err
 }
 
-func (m *Mongo) FindAll(filter Filter) (*[]Planet, error) {
+func (m *Mongo) Update(ctx context.Context, planet *Planet) (*Planet, error) {
+	query := versionQuery(planet.Id, planet.Version)
+
+	stamp(planet, false)
+
+	result, err := m.collection.ReplaceOne(ctx, query, planet)
+
+	if isDuplicateKey(err) {
+		return nil, m.duplicateError(ctx, planet, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if result.MatchedCount == 0 {
+		return nil, m.missingOrChanged(ctx, planet.Id)
+	}
+
+	return planet, nil
+}
+
+func (m *Mongo) FindAll(ctx context.Context, filter Filter) (*[]Planet, error) {
 	planet := make([]Planet, 0)
 
-	result, err := m.collection.Find(context.TODO(), mountFilter(filter))
+	query := mountFilter(filter)
+	opts := options.Find()
+
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit)
+	}
+
+	if filter.Offset > 0 {
+		opts.SetSkip(filter.Offset)
+	}
+
+	field, direction := filter.SortOrder()
+
+	if filter.After != "" || filter.Before != "" {
+		cursor, operator := filter.After, "$gt"
+		if filter.Before != "" {
+			cursor, operator, direction = filter.Before, "$lt", -1
+		}
+
+		id, err := primitive.ObjectIDFromHex(cursor)
+
+		if err != nil {
+			return &planet, err
+		}
+
+		query["_id"] = bson.M{operator: id}
+	}
+
+	sort := bson.D{{Key: "_id", Value: direction}}
+
+	if field != "_id" {
+		sort = append(bson.D{{Key: field, Value: direction}}, sort...)
+	}
+
+	result, err := m.collection.Find(ctx, query, opts.SetSort(sort))
 
 	if err == nil && result != nil {
-		err = result.All(context.TODO(), &planet)
+		err = result.All(ctx, &planet)
+	}
+
+	if filter.Before != "" {
+		reverse(planet)
 	}
 
 	return &planet, err
 }
 
-func (m *Mongo) FindById(id primitive.ObjectID) (*Planet, error) {
+func (m *Mongo) Count(ctx context.Context, filter Filter) (int64, error) {
+	return m.collection.CountDocuments(ctx, mountFilter(filter))
+}
+
+func (m *Mongo) FindById(ctx context.Context, id primitive.ObjectID) (*Planet, error) {
 	var result *Planet
 
-	cur, err := m.collection.Find(context.TODO(), bson.M{"_id": id})
+	err := m.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&result)
 
-	if err != nil {
-		return &Planet{}, err
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
 	}
 
-	if cur.Next(context.TODO()) != false {
-		err = cur.Decode(&result)
+	if err != nil {
+		return nil, err
 	}
 
-	return result, err
+	return result, nil
 }
 
-func (m *Mongo) Delete(id primitive.ObjectID) error {
+func (m *Mongo) Delete(ctx context.Context, id primitive.ObjectID) error {
 	filter := bson.M{"_id": id}
 
-	_, err := m.collection.DeleteOne(context.TODO(), filter)
+	result, err := m.collection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// FindIdempotencyRecord filters out expired records itself, since Mongo removes them only once a minute.
+func (m *Mongo) FindIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	var record IdempotencyRecord
+
+	err := m.idempotency.FindOne(ctx, bson.M{"_id": key, "expiresAt": bson.M{"$gt": time.Now()}}).Decode(&record)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrIdempotencyKeyNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	record.ExpiresAt = record.ExpiresAt.UTC()
+
+	return &record, nil
+}
+
+func (m *Mongo) SaveIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	_, err := m.idempotency.DeleteOne(ctx, bson.M{"_id": record.Key, "expiresAt": bson.M{"$lte": time.Now()}})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = m.idempotency.InsertOne(ctx, record)
+
+	if isDuplicateKey(err) {
+		return ErrIdempotencyKeyExists
+	}
 
 	return err
 }
 
-func mountFilter(filter Filter) bson.M{
-	f := bson.M{}
+// InsertMany inserts the planets in a single unordered write, so Mongo goes on past the ones failing.
+func (m *Mongo) InsertMany(ctx context.Context, planets []*Planet) []error {
+	errs := make([]error, len(planets))
+
+	if len(planets) == 0 {
+		return errs
+	}
+
+	documents := make([]interface{}, len(planets))
+
+	for i, planet := range planets {
+		if planet.Id.IsZero() {
+			planet.Id = primitive.NewObjectID()
+		}
+
+		stamp(planet, true)
+		documents[i] = planet
+	}
+
+	_, err := m.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+
+	var bulkError mongo.BulkWriteException
+
+	if err != nil && !errors.As(err, &bulkError) {
+		return errorsForAll(len(planets), err)
+	}
+
+	for _, writeError := range bulkError.WriteErrors {
+		planet := planets[writeError.Index]
+
+		if writeError.Code == 11000 {
+			errs[writeError.Index] = m.duplicateError(ctx, planet, writeError)
+		} else {
+			errs[writeError.Index] = writeError
+		}
+	}
+
+	return errs
+}
+
+func (m *Mongo) DeleteMany(ctx context.Context, filter Filter) (int64, error) {
+	result, err := m.collection.DeleteMany(ctx, mountFilter(filter))
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (m *Mongo) DeleteVersion(ctx context.Context, id primitive.ObjectID, version int64) error {
+	result, err := m.collection.DeleteOne(ctx, versionQuery(id, version))
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return m.missingOrChanged(ctx, id)
+	}
+
+	return nil
+}
+
+func (m *Mongo) MarkSynced(ctx context.Context, id primitive.ObjectID, syncedAt time.Time) error {
+	result, err := m.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"syncedAt": syncedAt}})
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// versionQuery matches the planet with id while it has version. Planets stored before versions were recorded have
+// no version field, matched by version 0.
+func versionQuery(id primitive.ObjectID, version int64) bson.M {
+	if version == 0 {
+		return bson.M{"_id": id, "version": bson.M{"$in": bson.A{int64(0), nil}}}
+	}
+	return bson.M{"_id": id, "version": version}
+}
+
+// missingOrChanged tells why a versioned write matched no planet.
+func (m *Mongo) missingOrChanged(ctx context.Context, id primitive.ObjectID) error {
+	count, err := m.collection.CountDocuments(ctx, bson.M{"_id": id})
+
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return ErrVersionConflict
+}
+
+func (m *Mongo) ReplaceIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	result, err := m.idempotency.ReplaceOne(ctx, bson.M{"_id": record.Key}, record)
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrIdempotencyKeyNotFound
+	}
+
+	return nil
+}
+
+func (m *Mongo) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	_, err := m.idempotency.DeleteOne(ctx, bson.M{"_id": key})
+
+	return err
+}
+
+// duplicateError looks up the planet holding the name of planet, returning err unchanged when there is none.
+func (m *Mongo) duplicateError(ctx context.Context, planet *Planet, err error) error {
+	var existing Planet
+
+	query := bson.M{"name": planet.Name, "_id": bson.M{"$ne": planet.Id}}
+
+	if m.collection.FindOne(ctx, query, options.FindOne().SetCollation(nameCollation)).Decode(&existing) != nil {
+		return err
+	}
+
+	return &DuplicateError{Id: existing.Id}
+}
+
+func isDuplicateKey(err error) bool {
+	var writeException mongo.WriteException
+	if errors.As(err, &writeException) {
+		for _, writeError := range writeException.WriteErrors {
+			if writeError.Code == 11000 {
+				return true
+			}
+		}
+	}
+
+	var commandError mongo.CommandError
+	return errors.As(err, &commandError) && commandError.Code == 11000
+}
+
+func mountFilter(filter Filter) bson.M {
+	conditions := make([]bson.M, 0)
 
 	if filter.Name != "" {
-		f["name"] = filter.Name
+		conditions = append(conditions, bson.M{"name": filter.Name})
+	}
+
+	if filter.NamePrefix != "" {
+		conditions = append(conditions, bson.M{"name": caseInsensitive("^" + regexp.QuoteMeta(filter.NamePrefix))})
+	}
+
+	if filter.NameContains != "" {
+		conditions = append(conditions, bson.M{"name": caseInsensitive(regexp.QuoteMeta(filter.NameContains))})
+	}
+
+	if len(filter.Weather) > 0 {
+		conditions = append(conditions, bson.M{"weather": bson.M{"$in": anyOf(filter.Weather)}})
+	}
+
+	if len(filter.Land) > 0 {
+		conditions = append(conditions, bson.M{"land": bson.M{"$in": anyOf(filter.Land)}})
+	}
+
+	appearanceQuantity := bson.M{}
+
+	for operator, value := range map[string]*int{
+		"$gt":  filter.AppearanceQuantityGt,
+		"$gte": filter.AppearanceQuantityGte,
+		"$lt":  filter.AppearanceQuantityLt,
+		"$lte": filter.AppearanceQuantityLte,
+	} {
+		if value != nil {
+			appearanceQuantity[operator] = *value
+		}
+	}
+
+	if len(appearanceQuantity) > 0 {
+		conditions = append(conditions, bson.M{"appearanceQuantity": appearanceQuantity})
+	}
+
+	if len(filter.Climate) > 0 {
+		conditions = append(conditions, bson.M{"swapi.climate": bson.M{"$in": anyOf(filter.Climate)}})
 	}
 
-	return f
+	if len(filter.Terrain) > 0 {
+		conditions = append(conditions, bson.M{"swapi.terrain": bson.M{"$in": anyOf(filter.Terrain)}})
+	}
+
+	if len(filter.Film) > 0 {
+		conditions = append(conditions, bson.M{"films.title": bson.M{"$in": anyOf(filter.Film)}})
+	}
+
+	for field, bounds := range map[string][2]*int64{
+		"swapi.diameter":   {filter.DiameterGte, filter.DiameterLte},
+		"swapi.population": {filter.PopulationGte, filter.PopulationLte},
+	} {
+		if bounds[0] != nil {
+			conditions = append(conditions, bson.M{field: bson.M{"$gte": *bounds[0]}})
+		}
+		if bounds[1] != nil {
+			conditions = append(conditions, bson.M{field: bson.M{"$lte": *bounds[1]}})
+		}
+	}
+
+	switch filter.Source {
+	case SourceSwapi:
+		conditions = append(conditions, bson.M{"source": bson.M{"$ne": SourceCustom}})
+	case SourceCustom:
+		conditions = append(conditions, bson.M{"source": SourceCustom})
+	}
+
+	if filter.MinResidents != nil && *filter.MinResidents > 0 {
+		lastResident := "swapi.residents." + strconv.Itoa(*filter.MinResidents-1)
+		conditions = append(conditions, bson.M{lastResident: bson.M{"$exists": true}})
+	}
+
+	if len(conditions) == 0 {
+		return bson.M{}
+	}
+
+	return bson.M{"$and": conditions}
+}
+
+// anyOf returns case-insensitive exact match patterns for values, to be used with $in.
+func anyOf(values []string) []primitive.Regex {
+	patterns := make([]primitive.Regex, 0, len(values))
+
+	for _, value := range values {
+		patterns = append(patterns, caseInsensitive("^"+regexp.QuoteMeta(value)+"$"))
+	}
+
+	return patterns
+}
+
+func caseInsensitive(pattern string) primitive.Regex {
+	return primitive.Regex{Pattern: pattern, Options: "i"}
+}
+
+func reverse(planets []Planet) {
+	for i, j := 0, len(planets)-1; i < j; i, j = i+1, j-1 {
+		planets[i], planets[j] = planets[j], planets[i]
+	}
 }
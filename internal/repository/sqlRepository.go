@@ -0,0 +1,689 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
+	"github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrations are applied in order and recorded in schema_migrations; append new ones, never edit applied ones.
+var migrations = []string{
+	`CREATE TABLE planets (
+		id CHAR(24) PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		weather VARCHAR(255) NOT NULL,
+		land VARCHAR(255) NOT NULL,
+		appearance_quantity INTEGER NOT NULL
+	)`,
+	`CREATE INDEX planets_name ON planets (name)`,
+	`CREATE UNIQUE INDEX planets_name_unique ON planets (LOWER(name))`,
+	`ALTER TABLE planets ADD COLUMN swapi TEXT`,
+	`ALTER TABLE planets ADD COLUMN swapi_diameter BIGINT`,
+	`ALTER TABLE planets ADD COLUMN swapi_population BIGINT`,
+	`ALTER TABLE planets ADD COLUMN swapi_climate TEXT`,
+	`ALTER TABLE planets ADD COLUMN swapi_terrain TEXT`,
+	`ALTER TABLE planets ADD COLUMN films TEXT`,
+	`ALTER TABLE planets ADD COLUMN film_titles TEXT`,
+	`ALTER TABLE planets ADD COLUMN swapi_residents INTEGER`,
+	`ALTER TABLE planets ADD COLUMN synced_at TEXT`,
+	`ALTER TABLE planets ADD COLUMN source TEXT NOT NULL DEFAULT 'swapi'`,
+	`ALTER TABLE planets ADD COLUMN created_at TEXT`,
+	`ALTER TABLE planets ADD COLUMN updated_at TEXT`,
+	`CREATE TABLE idempotency_keys (
+		idempotency_key VARCHAR(255) PRIMARY KEY,
+		request_hash VARCHAR(64) NOT NULL,
+		status INTEGER NOT NULL,
+		header TEXT NOT NULL,
+		body TEXT NOT NULL,
+		expires_at BIGINT NOT NULL
+	)`,
+	`ALTER TABLE planets ADD COLUMN version BIGINT NOT NULL DEFAULT 0`,
+}
+
+// sqlColumns maps the stored field names used by Filter.SortOrder to columns.
+var sqlColumns = map[string]string{
+	"_id":                "id",
+	"name":               "name",
+	"appearanceQuantity": "appearance_quantity",
+}
+
+// The swapi and films columns hold the SwapiData and films as JSON; the swapi_ and film_titles columns copy
+// the filterable parts of them, lists being kept lower case and enclosed in commas, like ",arid,temperate,".
+const planetColumns = "id, name, weather, land, appearance_quantity, source, version, swapi, films, synced_at, created_at, updated_at"
+
+const swapiColumns = "swapi_diameter, swapi_population, swapi_climate, swapi_terrain, film_titles, swapi_residents"
+
+type Sql struct {
+	db *sql.DB
+}
+
+// NewSqlSession opens the database and applies the pending migrations, failing when either does not work since
+// the repository can not serve without its schema.
+func NewSqlSession(config config.SqlConfig) (*Sql, error) {
+	s := new(Sql)
+
+	db, err := sql.Open(config.Driver, config.DSN)
+
+	if err != nil {
+		return nil, fmt.Errorf("error opening sql database: %w", err)
+	}
+
+	s.db = db
+
+	if err = s.migrate(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("error migrating sql database: %w", err)
+	}
+
+	return s, nil
+}
+
+func (s *Sql) migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+
+	if err != nil {
+		return err
+	}
+
+	var version int
+
+	if err = s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := s.db.Begin()
+
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec(migrations[version]); err == nil {
+			_, err = tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, version+1)
+		}
+
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Sql) Save(ctx context.Context, planet *Planet) (*Planet, error) {
+	if planet.Id.IsZero() {
+		planet.Id = primitive.NewObjectID()
+	}
+
+	stamp(planet, true)
+
+	swapi, err := swapiValues(planet)
+
+	if err != nil {
+		return planet, err
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO planets (`+planetColumns+`, `+swapiColumns+`) `+
+		`VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
+		append([]interface{}{planet.Id.Hex(), planet.Name, planet.Weather, planet.Land, planet.AppearanceQuantity, planet.Source,
+			planet.Version}, swapi...)...)
+
+	if isUniqueViolation(err) {
+		return planet, s.duplicateError(ctx, planet, err)
+	}
+
+	return planet, err
+}
+
+func (s *Sql) Update(ctx context.Context, planet *Planet) (*Planet, error) {
+	version := planet.Version
+
+	stamp(planet, false)
+
+	swapi, err := swapiValues(planet)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.ExecContext(ctx, `UPDATE planets SET name = $1, weather = $2, land = $3, appearance_quantity = $4, `+
+		`source = $5, version = $6, swapi = $7, films = $8, synced_at = $9, created_at = $10, updated_at = $11, swapi_diameter = $12, `+
+		`swapi_population = $13, swapi_climate = $14, swapi_terrain = $15, film_titles = $16, swapi_residents = $17 `+
+		`WHERE id = $18 AND version = $19`,
+		append(append([]interface{}{planet.Name, planet.Weather, planet.Land, planet.AppearanceQuantity, planet.Source,
+			planet.Version}, swapi...), planet.Id.Hex(), version)...)
+
+	if isUniqueViolation(err) {
+		return nil, s.duplicateError(ctx, planet, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if affected == 0 {
+		return nil, s.missingOrChanged(ctx, planet.Id)
+	}
+
+	return planet, nil
+}
+
+func (s *Sql) FindAll(ctx context.Context, filter Filter) (*[]Planet, error) {
+	planets := make([]Planet, 0)
+
+	where, args := mountWhere(filter)
+
+	field, direction := filter.SortOrder()
+
+	if filter.After != "" || filter.Before != "" {
+		cursor, operator := filter.After, ">"
+		if filter.Before != "" {
+			cursor, operator, direction = filter.Before, "<", -1
+		}
+
+		if _, err := primitive.ObjectIDFromHex(cursor); err != nil {
+			return &planets, err
+		}
+
+		args = append(args, cursor)
+		where = append(where, "id "+operator+" $"+strconv.Itoa(len(args)))
+	}
+
+	order := " ASC"
+	if direction < 0 {
+		order = " DESC"
+	}
+
+	query := `SELECT ` + planetColumns + ` FROM planets` + whereClause(where) + ` ORDER BY `
+
+	if field != "_id" {
+		query += sqlColumns[field] + order + ", "
+	}
+
+	query += "id" + order
+
+	if filter.Limit > 0 || filter.Offset > 0 {
+		limit := filter.Limit
+		if limit == 0 {
+			limit = math.MaxInt64
+		}
+
+		args = append(args, limit, filter.Offset)
+		query += " LIMIT $" + strconv.Itoa(len(args)-1) + " OFFSET $" + strconv.Itoa(len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return &planets, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		planet, err := scanPlanet(rows)
+
+		if err != nil {
+			return &planets, err
+		}
+
+		planets = append(planets, *planet)
+	}
+
+	if filter.Before != "" {
+		reverse(planets)
+	}
+
+	return &planets, rows.Err()
+}
+
+func (s *Sql) Count(ctx context.Context, filter Filter) (int64, error) {
+	where, args := mountWhere(filter)
+
+	var count int64
+
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM planets`+whereClause(where), args...).Scan(&count)
+
+	return count, err
+}
+
+func (s *Sql) FindById(ctx context.Context, id primitive.ObjectID) (*Planet, error) {
+	planet, err := scanPlanet(s.db.QueryRowContext(ctx, `SELECT `+planetColumns+` FROM planets WHERE id = $1`, id.Hex()))
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+
+	return planet, err
+}
+
+func (s *Sql) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM planets WHERE id = $1`, id.Hex())
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// InsertMany inserts the planets one by one, so one failing does not roll the others back.
+func (s *Sql) InsertMany(ctx context.Context, planets []*Planet) []error {
+	errs := make([]error, len(planets))
+
+	for i, planet := range planets {
+		_, errs[i] = s.Save(ctx, planet)
+	}
+
+	return errs
+}
+
+func (s *Sql) DeleteMany(ctx context.Context, filter Filter) (int64, error) {
+	where, args := mountWhere(filter)
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM planets`+whereClause(where), args...)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *Sql) DeleteVersion(ctx context.Context, id primitive.ObjectID, version int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM planets WHERE id = $1 AND version = $2`, id.Hex(), version)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err == nil && affected == 0 {
+		return s.missingOrChanged(ctx, id)
+	}
+
+	return err
+}
+
+func (s *Sql) MarkSynced(ctx context.Context, id primitive.ObjectID, syncedAt time.Time) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE planets SET synced_at = $1 WHERE id = $2`, formatTime(&syncedAt), id.Hex())
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// missingOrChanged tells why a versioned write matched no planet.
+func (s *Sql) missingOrChanged(ctx context.Context, id primitive.ObjectID) error {
+	var version int64
+
+	err := s.db.QueryRowContext(ctx, `SELECT version FROM planets WHERE id = $1`, id.Hex()).Scan(&version)
+
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return ErrVersionConflict
+}
+
+// FindIdempotencyRecord reads the record with key. Expiry times are stored as Unix milliseconds so expired records
+// can be compared, and purged, in SQL.
+func (s *Sql) FindIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	var record IdempotencyRecord
+	var header, body string
+	var expiresAt int64
+
+	row := s.db.QueryRowContext(ctx, `SELECT idempotency_key, request_hash, status, header, body, expires_at `+
+		`FROM idempotency_keys WHERE idempotency_key = $1 AND expires_at > $2`, key, unixMillis(time.Now()))
+
+	err := row.Scan(&record.Key, &record.RequestHash, &record.Status, &header, &body, &expiresAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrIdempotencyKeyNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal([]byte(header), &record.Header); err != nil {
+		return nil, err
+	}
+
+	record.Body = []byte(body)
+	record.ExpiresAt = time.Unix(0, expiresAt*int64(time.Millisecond)).UTC()
+
+	return &record, nil
+}
+
+func (s *Sql) SaveIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, unixMillis(time.Now()))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO idempotency_keys `+
+		`(idempotency_key, request_hash, status, header, body, expires_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		record.Key, record.RequestHash, record.Status, string(header), string(record.Body), unixMillis(record.ExpiresAt))
+
+	if isUniqueViolation(err) {
+		return ErrIdempotencyKeyExists
+	}
+
+	return err
+}
+
+func (s *Sql) ReplaceIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(ctx, `UPDATE idempotency_keys SET request_hash = $1, status = $2, header = $3, body = $4, `+
+		`expires_at = $5 WHERE idempotency_key = $6`,
+		record.RequestHash, record.Status, string(header), string(record.Body), unixMillis(record.ExpiresAt), record.Key)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err == nil && affected == 0 {
+		return ErrIdempotencyKeyNotFound
+	}
+
+	return err
+}
+
+func (s *Sql) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE idempotency_key = $1`, key)
+
+	return err
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// duplicateError looks up the planet holding the name of planet, returning err unchanged when there is none.
+func (s *Sql) duplicateError(ctx context.Context, planet *Planet, err error) error {
+	var id string
+
+	row := s.db.QueryRowContext(ctx, `SELECT id FROM planets WHERE LOWER(name) = LOWER($1) AND id <> $2`, planet.Name, planet.Id.Hex())
+
+	if row.Scan(&id) != nil {
+		return err
+	}
+
+	existing, idErr := primitive.ObjectIDFromHex(id)
+
+	if idErr != nil {
+		return err
+	}
+
+	return &DuplicateError{Id: existing}
+}
+
+func isUniqueViolation(err error) bool {
+	if isSqliteUniqueViolation(err) {
+		return true
+	}
+
+	var pqError *pq.Error
+	return errors.As(err, &pqError) && pqError.Code == "23505"
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPlanet(row scanner) (*Planet, error) {
+	planet := new(Planet)
+
+	var id string
+	var swapi, films, syncedAt, createdAt, updatedAt sql.NullString
+
+	err := row.Scan(&id, &planet.Name, &planet.Weather, &planet.Land, &planet.AppearanceQuantity, &planet.Source, &planet.Version,
+		&swapi, &films, &syncedAt, &createdAt, &updatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if swapi.Valid {
+		planet.Swapi = new(SwapiData)
+
+		if err = json.Unmarshal([]byte(swapi.String), planet.Swapi); err != nil {
+			return nil, err
+		}
+	}
+
+	if films.Valid {
+		if err = json.Unmarshal([]byte(films.String), &planet.Films); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, column := range []struct {
+		value sql.NullString
+		time  **time.Time
+	}{
+		{syncedAt, &planet.SyncedAt},
+		{createdAt, &planet.CreatedAt},
+		{updatedAt, &planet.UpdatedAt},
+	} {
+		if !column.value.Valid {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339Nano, column.value.String)
+
+		if err != nil {
+			return nil, err
+		}
+
+		*column.time = &parsed
+	}
+
+	planet.Id, err = primitive.ObjectIDFromHex(id)
+
+	return planet, err
+}
+
+// swapiValues returns the values of the planetColumns following version, then those of swapiColumns.
+func swapiValues(planet *Planet) ([]interface{}, error) {
+	values := []interface{}{nil, nil, formatTime(planet.SyncedAt), formatTime(planet.CreatedAt), formatTime(planet.UpdatedAt),
+		nil, nil, nil, nil, nil, nil}
+
+	if planet.Swapi != nil {
+		document, err := json.Marshal(planet.Swapi)
+
+		if err != nil {
+			return nil, err
+		}
+
+		values[0], values[5], values[6] = string(document), planet.Swapi.Diameter, planet.Swapi.Population
+		values[7], values[8] = joinValues(planet.Swapi.Climate), joinValues(planet.Swapi.Terrain)
+		values[10] = len(planet.Swapi.Residents)
+	}
+
+	if planet.Films != nil {
+		document, err := json.Marshal(planet.Films)
+
+		if err != nil {
+			return nil, err
+		}
+
+		titles := make([]string, 0, len(planet.Films))
+		for _, film := range planet.Films {
+			titles = append(titles, film.Title)
+		}
+
+		values[1], values[9] = string(document), joinValues(titles)
+	}
+
+	return values, nil
+}
+
+// formatTime stores times as RFC 3339 text in UTC, read back the same way by every supported database.
+func formatTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func joinValues(values []string) string {
+	return "," + strings.ToLower(strings.Join(values, ",")) + ","
+}
+
+// mountWhere translates filter into SQL conditions and their positional arguments,
+// with the same semantics as mountFilter.
+func mountWhere(filter Filter) ([]string, []interface{}) {
+	where := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if filter.Name != "" {
+		where = append(where, "name = "+arg(filter.Name))
+	}
+
+	if filter.NamePrefix != "" {
+		where = append(where, `LOWER(name) LIKE `+arg(strings.ToLower(escapeLike(filter.NamePrefix))+"%")+` ESCAPE '\'`)
+	}
+
+	if filter.NameContains != "" {
+		where = append(where, `LOWER(name) LIKE `+arg("%"+strings.ToLower(escapeLike(filter.NameContains))+"%")+` ESCAPE '\'`)
+	}
+
+	for column, values := range map[string][]string{"weather": filter.Weather, "land": filter.Land} {
+		if len(values) == 0 {
+			continue
+		}
+
+		placeholders := make([]string, 0, len(values))
+		for _, value := range values {
+			placeholders = append(placeholders, arg(strings.ToLower(value)))
+		}
+
+		where = append(where, "LOWER("+column+") IN ("+strings.Join(placeholders, ", ")+")")
+	}
+
+	for operator, value := range map[string]*int{
+		">":  filter.AppearanceQuantityGt,
+		">=": filter.AppearanceQuantityGte,
+		"<":  filter.AppearanceQuantityLt,
+		"<=": filter.AppearanceQuantityLte,
+	} {
+		if value != nil {
+			where = append(where, "appearance_quantity "+operator+" "+arg(*value))
+		}
+	}
+
+	for column, values := range map[string][]string{
+		"swapi_climate": filter.Climate,
+		"swapi_terrain": filter.Terrain,
+		"film_titles":   filter.Film,
+	} {
+		if len(values) == 0 {
+			continue
+		}
+
+		alternatives := make([]string, 0, len(values))
+		for _, value := range values {
+			alternatives = append(alternatives, column+` LIKE `+arg("%,"+strings.ToLower(escapeLike(value))+",%")+` ESCAPE '\'`)
+		}
+
+		where = append(where, "("+strings.Join(alternatives, " OR ")+")")
+	}
+
+	for column, bounds := range map[string][2]*int64{
+		"swapi_diameter":   {filter.DiameterGte, filter.DiameterLte},
+		"swapi_population": {filter.PopulationGte, filter.PopulationLte},
+	} {
+		if bounds[0] != nil {
+			where = append(where, column+" >= "+arg(*bounds[0]))
+		}
+		if bounds[1] != nil {
+			where = append(where, column+" <= "+arg(*bounds[1]))
+		}
+	}
+
+	switch filter.Source {
+	case SourceSwapi:
+		where = append(where, "source <> "+arg(SourceCustom))
+	case SourceCustom:
+		where = append(where, "source = "+arg(SourceCustom))
+	}
+
+	if filter.MinResidents != nil {
+		where = append(where, "COALESCE(swapi_residents, 0) >= "+arg(*filter.MinResidents))
+	}
+
+	return where, args
+}
+
+func whereClause(where []string) string {
+	if len(where) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(where, " AND ")
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
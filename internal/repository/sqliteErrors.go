@@ -0,0 +1,16 @@
+//go:build cgo
+// +build cgo
+
+package repository
+
+import (
+	"errors"
+	"github.com/mattn/go-sqlite3"
+)
+
+// isSqliteUniqueViolation matches unique index and primary key violations, which postgres reports alike.
+func isSqliteUniqueViolation(err error) bool {
+	var sqliteError sqlite3.Error
+	return errors.As(err, &sqliteError) &&
+		(sqliteError.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteError.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
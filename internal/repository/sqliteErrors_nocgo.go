@@ -0,0 +1,9 @@
+//go:build !cgo
+// +build !cgo
+
+package repository
+
+// isSqliteUniqueViolation is always false without cgo, where the sqlite3 driver is not available.
+func isSqliteUniqueViolation(err error) bool {
+	return false
+}
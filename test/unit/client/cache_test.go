@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
+	client2 "github.com/bernardoms/StarWarsPlanetAPI-GO/internal/client"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/test/unit/mock"
+	"github.com/stretchr/testify/assert"
+	mock2 "github.com/stretchr/testify/mock"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestCacheConfig() config.CacheConfig {
+	return config.CacheConfig{Size: 10, TTL: time.Hour, NegativeTTL: time.Hour}
+}
+
+func newCacheLoggerMock() *mock.LoggerMock {
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+	return mockLogger
+}
+
+func TestShouldAnswerRepeatedSearchFromCache(t *testing.T) {
+	swapiMock := new(mock.SwapiClientMock)
+	swapiResponse := client2.SwapiPlanet{Results: []client2.Results{{Name: "Hoth"}}}
+	swapiMock.On("GetPlanetByName", "Hoth").Return(&swapiResponse, nil)
+
+	cached := client2.NewCachedSwapiClient(swapiMock, newTestCacheConfig(), newCacheLoggerMock())
+
+	first, err := cached.GetPlanetByName(context.Background(), "Hoth")
+	assert.NoError(t, err)
+	second, err := cached.GetPlanetByName(context.Background(), "hoth")
+	assert.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	swapiMock.AssertNumberOfCalls(t, "GetPlanetByName", 1)
+	assert.Equal(t, client2.CacheStats{Hits: 1, Misses: 1}, cached.Stats())
+}
+
+func TestShouldCacheUnknownNames(t *testing.T) {
+	swapiMock := new(mock.SwapiClientMock)
+	var notFound *client2.SwapiPlanet
+	swapiMock.On("GetPlanetByName", "Aldebaran").Return(notFound, nil)
+
+	cached := client2.NewCachedSwapiClient(swapiMock, newTestCacheConfig(), newCacheLoggerMock())
+
+	_, _ = cached.GetPlanetByName(context.Background(), "Aldebaran")
+	planets, err := cached.GetPlanetByName(context.Background(), "Aldebaran")
+
+	assert.NoError(t, err)
+	assert.Nil(t, planets)
+	swapiMock.AssertNumberOfCalls(t, "GetPlanetByName", 1)
+}
+
+func TestShouldFetchAgainWhenEntryExpired(t *testing.T) {
+	swapiMock := new(mock.SwapiClientMock)
+	swapiResponse := client2.SwapiPlanet{Results: []client2.Results{{Name: "Hoth"}}}
+	swapiMock.On("GetPlanetByName", "Hoth").Return(&swapiResponse, nil)
+
+	cacheConfig := newTestCacheConfig()
+	cacheConfig.TTL = 0
+
+	cached := client2.NewCachedSwapiClient(swapiMock, cacheConfig, newCacheLoggerMock())
+
+	_, _ = cached.GetPlanetByName(context.Background(), "Hoth")
+	_, _ = cached.GetPlanetByName(context.Background(), "Hoth")
+
+	swapiMock.AssertNumberOfCalls(t, "GetPlanetByName", 2)
+	assert.Equal(t, client2.CacheStats{Misses: 2}, cached.Stats())
+}
+
+func TestShouldRevalidateExpiredEntryWithETag(t *testing.T) {
+	var full, conditional int32
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&conditional, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			atomic.AddInt32(&full, 1)
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte(alderaanResponse))
+		}))
+	defer ts.Close()
+	mockLogger := newCacheLoggerMock()
+	cacheConfig := newTestCacheConfig()
+	cacheConfig.TTL = 0
+
+	cached := client2.NewCachedSwapiClient(client2.NewSwapiClientWithConfig(ts.URL+"/", newTestSwapiConfig(), mockLogger),
+		cacheConfig, mockLogger)
+
+	_, _ = cached.GetPlanetByName(context.Background(), "Alderaan")
+	planets, err := cached.GetPlanetByName(context.Background(), "Alderaan")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Alderaan", planets.Results[0].Name)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&full))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conditional))
+	assert.Equal(t, client2.CacheStats{Misses: 1, Revalidations: 1}, cached.Stats())
+}
+
+func TestShouldEvictLeastRecentlyUsedEntry(t *testing.T) {
+	store := client2.NewLruStore(2, nil)
+
+	store.Set("tatooine", client2.CacheEntry{})
+	store.Set("hoth", client2.CacheEntry{})
+	_, _ = store.Get("tatooine")
+	store.Set("dagobah", client2.CacheEntry{})
+
+	_, tatooine := store.Get("tatooine")
+	_, hoth := store.Get("hoth")
+	_, dagobah := store.Get("dagobah")
+
+	assert.True(t, tatooine)
+	assert.False(t, hoth)
+	assert.True(t, dagobah)
+}
+
+func TestShouldKeepEntriesOnDiskAcrossStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swapi-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mockLogger := newCacheLoggerMock()
+	entry := client2.CacheEntry{
+		Planets:    &client2.SwapiPlanet{Count: 1, Results: []client2.Results{{Name: "Hoth"}}},
+		Validators: client2.Validators{ETag: `"v1"`},
+		StoredAt:   time.Now().UTC().Truncate(time.Second),
+	}
+
+	client2.NewLruStore(1, client2.NewDiskStore(dir, mockLogger)).Set("hoth", entry)
+
+	found, ok := client2.NewLruStore(1, client2.NewDiskStore(dir, mockLogger)).Get("hoth")
+
+	assert.True(t, ok)
+	assert.Equal(t, entry, found)
+}
+
+func TestShouldAskOnlyForFilmsNotCached(t *testing.T) {
+	swapiMock := new(mock.SwapiClientMock)
+	newHope := client2.SwapiFilm{Title: "A New Hope", Url: "https://swapi.dev/api/films/1/"}
+	empire := client2.SwapiFilm{Title: "The Empire Strikes Back", Url: "https://swapi.dev/api/films/2/"}
+	swapiMock.On("GetFilms", []string{newHope.Url}).Return([]client2.SwapiFilm{newHope}, nil)
+	swapiMock.On("GetFilms", []string{empire.Url}).Return([]client2.SwapiFilm{empire}, nil)
+
+	cached := client2.NewCachedSwapiClient(swapiMock, newTestCacheConfig(), newCacheLoggerMock())
+
+	_, err := cached.GetFilms(context.Background(), []string{newHope.Url})
+	assert.NoError(t, err)
+	films, err := cached.GetFilms(context.Background(), []string{empire.Url, newHope.Url})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []client2.SwapiFilm{empire, newHope}, films)
+	swapiMock.AssertNumberOfCalls(t, "GetFilms", 2)
+}
+
+func TestShouldAnswerRepeatedResidentFromCache(t *testing.T) {
+	swapiMock := new(mock.SwapiClientMock)
+	luke := client2.SwapiPerson{Name: "Luke Skywalker", Url: "https://swapi.dev/api/people/1/"}
+	swapiMock.On("GetPeople", []string{luke.Url}).Return([]client2.SwapiPerson{luke}, nil)
+
+	cached := client2.NewCachedSwapiClient(swapiMock, newTestCacheConfig(), newCacheLoggerMock())
+
+	_, err := cached.GetPeople(context.Background(), []string{luke.Url})
+	assert.NoError(t, err)
+	person, err := cached.GetPerson(context.Background(), "http://swapi.dev/api/people/1/")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &luke, person)
+	swapiMock.AssertNumberOfCalls(t, "GetPeople", 1)
+}
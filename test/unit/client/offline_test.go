@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"errors"
+	client2 "github.com/bernardoms/StarWarsPlanetAPI-GO/internal/client"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/test/unit/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestSnapshot loads the hand-written snapshot in testdata, a small subset of SWAPI.
+func loadTestSnapshot(t *testing.T) *client2.Snapshot {
+	snapshot, err := client2.LoadSnapshot("testdata/swapi.json")
+	require.NoError(t, err)
+	return snapshot
+}
+
+func TestShouldFindPlanetsInSnapshot(t *testing.T) {
+	offline := client2.NewOfflineSwapiClient(loadTestSnapshot(t))
+
+	planets, err := offline.GetPlanetByName(context.Background(), "hoth")
+
+	require.NoError(t, err)
+	planet, err := planets.Match("Hoth")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://swapi.dev/api/films/2/"}, planet.Films)
+
+	film, err := offline.GetFilm(context.Background(), "http://swapi.dev/api/films/2/")
+
+	require.NoError(t, err)
+	assert.Equal(t, "The Empire Strikes Back", film.Title)
+
+	person, err := offline.GetPerson(context.Background(), "https://swapi.dev/api/people/1/")
+
+	require.NoError(t, err)
+	assert.Equal(t, "Luke Skywalker", person.Name)
+
+	unknown, err := offline.GetPlanetByName(context.Background(), "Aldebaran")
+
+	assert.NoError(t, err)
+	assert.Nil(t, unknown)
+}
+
+func TestShouldLinkEveryFilmAndResidentOfTestSnapshot(t *testing.T) {
+	snapshot := loadTestSnapshot(t)
+	offline := client2.NewOfflineSwapiClient(snapshot)
+
+	for _, planet := range snapshot.Planets {
+		for _, url := range planet.Films {
+			film, err := offline.GetFilm(context.Background(), url)
+			assert.NoError(t, err)
+			assert.NotNil(t, film, url)
+		}
+		for _, url := range planet.Residents {
+			person, err := offline.GetPerson(context.Background(), url)
+			assert.NoError(t, err)
+			assert.NotNil(t, person, url)
+		}
+	}
+}
+
+func TestShouldBuildSnapshotFromLiveApi(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/planets":
+				_, _ = w.Write([]byte(strings.Replace(`{"count": 1, "results": [{"name": "Hoth", "url": "URL/planets/4/",
+					"films": ["URL/films/2/"], "residents": ["URL/people/1/", "URL/people/1/"]}]}`, "URL", ts.URL, -1)))
+			case "/films/2/":
+				_, _ = w.Write([]byte(`{"title": "The Empire Strikes Back", "episode_id": 5}`))
+			case "/people/1/":
+				_, _ = w.Write([]byte(`{"name": "Luke Skywalker"}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer ts.Close()
+	mockLogger := new(mock.LoggerMock)
+	live := client2.NewSwapiClientWithConfig(ts.URL+"/", newTestSwapiConfig(), mockLogger)
+
+	snapshot, err := client2.BuildSnapshot(context.Background(), live, ts.URL+"/")
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(snapshot.Planets))
+	assert.Equal(t, []client2.SwapiFilm{{Title: "The Empire Strikes Back", EpisodeId: 5}}, snapshot.Films)
+	assert.Equal(t, []client2.SwapiPerson{{Name: "Luke Skywalker"}}, snapshot.People)
+
+	dir, err := ioutil.TempDir("", "swapi-snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "swapi.json")
+	require.NoError(t, snapshot.Write(path))
+
+	loaded, err := client2.LoadSnapshot(path)
+
+	require.NoError(t, err)
+	assert.Equal(t, snapshot.Planets, loaded.Planets)
+	assert.True(t, snapshot.FetchedAt.Equal(loaded.FetchedAt))
+}
+
+func TestShouldFallBackToSnapshotWhenSwapiFails(t *testing.T) {
+	swapiMock := new(mock.SwapiClientMock)
+	var none *client2.SwapiPlanet
+	swapiMock.On("GetPlanetByName", "Hoth").Return(none, client2.ErrCircuitOpen)
+
+	fallback := client2.NewFallbackSwapiClient(swapiMock, client2.NewOfflineSwapiClient(loadTestSnapshot(t)), newCacheLoggerMock())
+
+	planets, err := fallback.GetPlanetByName(context.Background(), "Hoth")
+
+	require.NoError(t, err)
+	assert.Equal(t, "Hoth", planets.Results[0].Name)
+}
+
+func TestShouldNotFallBackWhenRequestIsCanceled(t *testing.T) {
+	swapiMock := new(mock.SwapiClientMock)
+	var none *client2.SwapiPlanet
+	swapiMock.On("GetPlanetByName", "Hoth").Return(none, context.Canceled)
+
+	fallback := client2.NewFallbackSwapiClient(swapiMock, client2.NewOfflineSwapiClient(loadTestSnapshot(t)), newCacheLoggerMock())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := fallback.GetPlanetByName(ctx, "Hoth")
+
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestShouldListSnapshotPlanetsWhenLiveListingFails(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+	defer ts.Close()
+	mockLogger := newCacheLoggerMock()
+	live := client2.NewSwapiClientWithConfig(ts.URL+"/", newTestSwapiConfig(), mockLogger)
+	snapshot := loadTestSnapshot(t)
+
+	fallback := client2.NewFallbackSwapiClient(live, client2.NewOfflineSwapiClient(snapshot), mockLogger)
+
+	it := fallback.ListPlanets(context.Background(), "")
+	defer it.Close()
+
+	count := 0
+	for it.Next() {
+		count++
+	}
+
+	assert.NoError(t, it.Err())
+	assert.Equal(t, len(snapshot.Planets), count)
+}
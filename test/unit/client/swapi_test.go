@@ -1,14 +1,35 @@
 package client
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
 	client2 "github.com/bernardoms/StarWarsPlanetAPI-GO/internal/client"
 	"github.com/bernardoms/StarWarsPlanetAPI-GO/test/unit/mock"
 	"github.com/stretchr/testify/assert"
+	mock2 "github.com/stretchr/testify/mock"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
+const alderaanResponse = `{"count": 1, "next": null, "previous": null, "results": [{"name": "Alderaan", "films": ["http://swapi.dev/api/films/1/"]}]}`
+
+func newTestSwapiConfig() config.SwapiConfig {
+	return config.SwapiConfig{
+		Timeout:     200 * time.Millisecond,
+		MaxRetries:  2,
+		BackoffBase: time.Millisecond,
+		BackoffMax:  2 * time.Second,
+	}
+}
+
 func TestShouldReturnPlanetWithSuccessFromGet(t *testing.T) {
 	ts := httptest.NewServer(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -50,7 +71,7 @@ func TestShouldReturnPlanetWithSuccessFromGet(t *testing.T) {
 	defer ts.Close()
 	mockLogger := new(mock.LoggerMock)
 	client := client2.NewSwapiClient(ts.URL+"/", mockLogger)
-	planet, err := client.GetPlanetByName("Aldebaran")
+	planet, err := client.GetPlanetByName(context.Background(), "Aldebaran")
 
 	assert.Equal(t, nil, err)
 	assert.Equal(t, "Alderaan", planet.Results[0].Name)
@@ -73,8 +94,408 @@ func TestShouldReturnPlanetNilWhenApiReturnsNotFound(t *testing.T) {
 	mockLogger := new(mock.LoggerMock)
 	client := client2.NewSwapiClient(ts.URL+"/", mockLogger)
 
-	planet, err := client.GetPlanetByName("Aldebaran")
+	planet, err := client.GetPlanetByName(context.Background(), "Aldebaran")
 
 	assert.NoError(t, err)
 	assert.Nil(t, planet)
 }
+
+func TestShouldRetryWhenApiReturnsServerError(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_, _ = w.Write([]byte(alderaanResponse))
+		}))
+	defer ts.Close()
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+	client := client2.NewSwapiClientWithConfig(ts.URL+"/", newTestSwapiConfig(), mockLogger)
+
+	planet, err := client.GetPlanetByName(context.Background(), "Alderaan")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Alderaan", planet.Results[0].Name)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestShouldGiveUpAfterMaxRetries(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+	defer ts.Close()
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+	client := client2.NewSwapiClientWithConfig(ts.URL+"/", newTestSwapiConfig(), mockLogger)
+
+	planet, err := client.GetPlanetByName(context.Background(), "Alderaan")
+
+	var upstream *client2.UpstreamError
+	assert.True(t, errors.As(err, &upstream))
+	assert.Nil(t, planet)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestShouldNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+	defer ts.Close()
+	mockLogger := new(mock.LoggerMock)
+	client := client2.NewSwapiClientWithConfig(ts.URL+"/", newTestSwapiConfig(), mockLogger)
+
+	_, err := client.GetPlanetByName(context.Background(), "Alderaan")
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestShouldHonorRetryAfterWhenRateLimited(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			_, _ = w.Write([]byte(alderaanResponse))
+		}))
+	defer ts.Close()
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+	client := client2.NewSwapiClientWithConfig(ts.URL+"/", newTestSwapiConfig(), mockLogger)
+
+	start := time.Now()
+	planet, err := client.GetPlanetByName(context.Background(), "Alderaan")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Alderaan", planet.Results[0].Name)
+	assert.True(t, time.Since(start) >= time.Second)
+}
+
+func TestShouldNotWaitWhenRetryAfterIsLongerThanMaxBackoff(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+	defer ts.Close()
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+	client := client2.NewSwapiClientWithConfig(ts.URL+"/", newTestSwapiConfig(), mockLogger)
+
+	_, err := client.GetPlanetByName(context.Background(), "Alderaan")
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestShouldTimeoutSlowApi(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(500 * time.Millisecond)
+			_, _ = w.Write([]byte(alderaanResponse))
+		}))
+	defer ts.Close()
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+	swapiConfig := newTestSwapiConfig()
+	swapiConfig.MaxRetries = 0
+	client := client2.NewSwapiClientWithConfig(ts.URL+"/", swapiConfig, mockLogger)
+
+	start := time.Now()
+	_, err := client.GetPlanetByName(context.Background(), "Alderaan")
+
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 400*time.Millisecond)
+}
+
+func TestShouldOpenCircuitAfterConsecutiveFailures(t *testing.T) {
+	var calls int32
+	var healthy int32
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			if atomic.LoadInt32(&healthy) == 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write([]byte(alderaanResponse))
+		}))
+	defer ts.Close()
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+	swapiConfig := newTestSwapiConfig()
+	swapiConfig.MaxRetries = 0
+	swapiConfig.BreakerThreshold = 2
+	swapiConfig.BreakerCooldown = 100 * time.Millisecond
+	client := client2.NewSwapiClientWithConfig(ts.URL+"/", swapiConfig, mockLogger)
+
+	_, _ = client.GetPlanetByName(context.Background(), "Alderaan")
+	_, _ = client.GetPlanetByName(context.Background(), "Alderaan")
+	_, err := client.GetPlanetByName(context.Background(), "Alderaan")
+
+	var circuitOpen *client2.CircuitOpenError
+	assert.True(t, errors.As(err, &circuitOpen))
+	assert.True(t, errors.Is(err, client2.ErrCircuitOpen))
+	assert.Equal(t, 100*time.Millisecond, circuitOpen.RetryAfter)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(150 * time.Millisecond)
+
+	planet, err := client.GetPlanetByName(context.Background(), "Alderaan")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Alderaan", planet.Results[0].Name)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestShouldEscapePlanetNameInQuery(t *testing.T) {
+	var search string
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			search = r.URL.Query().Get("search")
+			_, _ = w.Write([]byte(alderaanResponse))
+		}))
+	defer ts.Close()
+	mockLogger := new(mock.LoggerMock)
+	client := client2.NewSwapiClient(ts.URL+"/", mockLogger)
+
+	_, err := client.GetPlanetByName(context.Background(), "Yavin IV&format=wookiee")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Yavin IV&format=wookiee", search)
+}
+
+func TestShouldStopRetryingWhenContextIsCanceled(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+	defer ts.Close()
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+	swapiConfig := newTestSwapiConfig()
+	swapiConfig.BackoffBase = time.Hour
+	swapiConfig.BackoffMax = time.Hour
+	swapiConfig.BreakerThreshold = 1
+	client := client2.NewSwapiClientWithConfig(ts.URL+"/", swapiConfig, mockLogger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetPlanetByName(ctx, "Alderaan")
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, time.Since(start) < time.Second)
+	assert.True(t, atomic.LoadInt32(&calls) <= 2)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = client.GetPlanetByName(ctx, "Alderaan")
+
+	assert.False(t, errors.Is(err, client2.ErrCircuitOpen))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestShouldAbortRequestWhenContextIsCanceled(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}))
+	defer ts.Close()
+	defer close(release)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+	swapiConfig := newTestSwapiConfig()
+	swapiConfig.Timeout = 0
+	client := client2.NewSwapiClientWithConfig(ts.URL+"/", swapiConfig, mockLogger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := client.GetPlanetByName(ctx, "Alderaan")
+
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestShouldMatchPlanetNameExactlyIgnoringCase(t *testing.T) {
+	planets := client2.SwapiPlanet{Results: []client2.Results{{Name: "Hoth Prime"}, {Name: "Hoth"}}}
+
+	planet, err := planets.Match("hoth")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Hoth", planet.Name)
+}
+
+func TestShouldNotMatchWhenNoPlanetHasTheExactName(t *testing.T) {
+	planets := client2.SwapiPlanet{Results: []client2.Results{{Name: "Hoth Prime"}}}
+
+	_, err := planets.Match("Hoth")
+
+	var match *client2.MatchError
+	assert.True(t, errors.Is(err, client2.ErrPlanetNotFound))
+	assert.True(t, errors.As(err, &match))
+	assert.Equal(t, []string{"Hoth Prime"}, match.Candidates)
+
+	var empty *client2.SwapiPlanet
+
+	_, err = empty.Match("Hoth")
+
+	assert.True(t, errors.Is(err, client2.ErrPlanetNotFound))
+}
+
+func TestShouldNotMatchWhenSeveralPlanetsHaveTheExactName(t *testing.T) {
+	planets := client2.SwapiPlanet{Results: []client2.Results{{Name: "Hoth"}, {Name: "Hoth Prime"}, {Name: "HOTH"}}}
+
+	_, err := planets.Match("Hoth")
+
+	var match *client2.MatchError
+	assert.True(t, errors.Is(err, client2.ErrAmbiguousPlanet))
+	assert.True(t, errors.As(err, &match))
+	assert.Equal(t, []string{"Hoth", "HOTH"}, match.Candidates)
+}
+
+// newCatalogueServer serves planets two per page, counting the requests made for each page.
+func newCatalogueServer(planets []string, requests map[string]int, mutex *sync.Mutex) *httptest.Server {
+	var ts *httptest.Server
+	ts = httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			page, err := strconv.Atoi(r.URL.Query().Get("page"))
+			if err != nil {
+				page = 1
+			}
+
+			mutex.Lock()
+			requests[strconv.Itoa(page)]++
+			mutex.Unlock()
+
+			response := client2.SwapiPlanet{Count: len(planets)}
+
+			for i := (page - 1) * 2; i < len(planets) && i < page*2; i++ {
+				response.Results = append(response.Results, client2.Results{Name: planets[i]})
+			}
+
+			if page*2 < len(planets) {
+				response.Next = fmt.Sprintf("%s/planets?page=%d", ts.URL, page+1)
+			}
+
+			_ = json.NewEncoder(w).Encode(response)
+		}))
+	return ts
+}
+
+func TestShouldListEveryPlanetFollowingPagination(t *testing.T) {
+	planets := []string{"Tatooine", "Alderaan", "Yavin IV", "Hoth", "Dagobah"}
+	requests := map[string]int{}
+	mutex := new(sync.Mutex)
+	ts := newCatalogueServer(planets, requests, mutex)
+	defer ts.Close()
+	mockLogger := new(mock.LoggerMock)
+	swapiConfig := newTestSwapiConfig()
+	swapiConfig.PageConcurrency = 2
+	client := client2.NewSwapiClientWithConfig(ts.URL+"/", swapiConfig, mockLogger)
+
+	it := client.ListPlanets(context.Background(), "")
+	defer it.Close()
+
+	var names []string
+	for it.Next() {
+		names = append(names, it.Planet().Name)
+	}
+
+	assert.NoError(t, it.Err())
+	assert.Equal(t, planets, names)
+	assert.Equal(t, map[string]int{"1": 1, "2": 1, "3": 1}, requests)
+}
+
+func TestShouldGatherEverySearchPageWhenGettingPlanetByName(t *testing.T) {
+	planets := []string{"Hoth Prime", "Hoth Minor", "Hoth"}
+	requests := map[string]int{}
+	mutex := new(sync.Mutex)
+	ts := newCatalogueServer(planets, requests, mutex)
+	defer ts.Close()
+	mockLogger := new(mock.LoggerMock)
+	client := client2.NewSwapiClientWithConfig(ts.URL+"/", newTestSwapiConfig(), mockLogger)
+
+	found, err := client.GetPlanetByName(context.Background(), "Hoth")
+
+	assert.NoError(t, err)
+	planet, err := found.Match("Hoth")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hoth", planet.Name)
+}
+
+func TestShouldStopListingWhenPageFails(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("page") == "2" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"count": 4, "next": "http://` + r.Host + `/planets?page=2", "results": [{"name": "Tatooine"}, {"name": "Alderaan"}]}`))
+		}))
+	defer ts.Close()
+	mockLogger := new(mock.LoggerMock)
+	client := client2.NewSwapiClientWithConfig(ts.URL+"/", newTestSwapiConfig(), mockLogger)
+
+	it := client.ListPlanets(context.Background(), "")
+	defer it.Close()
+
+	count := 0
+	for it.Next() {
+		count++
+	}
+
+	assert.Equal(t, 2, count)
+	assert.Error(t, it.Err())
+}
+
+func TestShouldGetFilmsInOrderWithoutRepetitionsNorUnknownFilms(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			switch r.URL.Path {
+			case "/films/1/":
+				_, _ = w.Write([]byte(`{"title": "A New Hope", "episode_id": 4, "release_date": "1977-05-25", "url": "http://swapi.dev/api/films/1/"}`))
+			case "/films/2/":
+				_, _ = w.Write([]byte(`{"title": "The Empire Strikes Back", "episode_id": 5, "release_date": "1980-05-17", "url": "http://swapi.dev/api/films/2/"}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer ts.Close()
+	mockLogger := new(mock.LoggerMock)
+	client := client2.NewSwapiClient(ts.URL+"/", mockLogger)
+
+	films, err := client.GetFilms(context.Background(), []string{ts.URL + "/films/2/", ts.URL + "/films/9/", ts.URL + "/films/1/", ts.URL + "/films/2/"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []client2.SwapiFilm{
+		{Title: "The Empire Strikes Back", EpisodeId: 5, ReleaseDate: "1980-05-17", Url: "http://swapi.dev/api/films/2/"},
+		{Title: "A New Hope", EpisodeId: 4, ReleaseDate: "1977-05-25", Url: "http://swapi.dev/api/films/1/"},
+	}, films)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
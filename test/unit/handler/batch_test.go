@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/client"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/handler"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/test/unit/mock"
+	"github.com/stretchr/testify/assert"
+	mock2 "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestShouldCreatePlanetsInBatchReportingEachOne(t *testing.T) {
+	var notFound *client.SwapiPlanet
+
+	repo := repository.NewMemory()
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	swapiMock.On("GetPlanetByName", "Tatooine").Return(&client.SwapiPlanet{Results: []client.Results{{Name: "Tatooine",
+		Url: "https://swapi.dev/api/planets/1/", Films: []string{"1", "2", "3"}}}}, nil)
+	swapiMock.On("GetPlanetByName", "Nowhere").Return(notFound, nil)
+	swapiMock.On("GetFilms", mock2.Anything).Return([]client.SwapiFilm{}, nil)
+
+	h := handler.NewPlanetHandler(repo, swapiMock, mockLogger)
+
+	r, _ := http.NewRequest("POST", "/v1/planets:batch", bytes.NewBufferString(`[
+		{"name":"Tatooine","weather":"arid","land":"desert"},
+		{"name":"Zeltros","weather":"temperate","land":"plains","source":"custom"},
+		{"name":"Kessel","source":"custom"},
+		{"name":"ZELTROS","weather":"arid","land":"plains","source":"custom"},
+		{"name":"Nowhere","weather":"arid","land":"desert"}
+	]`))
+
+	w := httptest.NewRecorder()
+
+	h.SavePlanets(w, r)
+
+	var response handler.BatchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, response.Results, 5)
+
+	var statuses []int
+	for _, result := range response.Results {
+		statuses = append(statuses, result.Status)
+	}
+	assert.Equal(t, []int{201, 201, 422, 409, 404}, statuses)
+
+	tatooine := response.Results[0]
+	assert.Equal(t, "/v1/planets/"+tatooine.Planet.Id, tatooine.Location)
+	assert.Equal(t, 3, tatooine.Planet.AppearanceQuantity)
+	assert.Equal(t, repository.SourceSwapi, tatooine.Planet.Source)
+
+	assert.Equal(t, "/problems/invalid-planet", response.Results[2].Problem.Type)
+	assert.Equal(t, "/problems/duplicate-planet", response.Results[3].Problem.Type)
+	assert.Equal(t, "/problems/swapi-planet-not-found", response.Results[4].Problem.Type)
+
+	swapiMock.AssertNumberOfCalls(t, "GetPlanetByName", 2)
+
+	count, _ := repo.Count(context.Background(), repository.Filter{})
+	assert.Equal(t, int64(2), count)
+}
+
+func TestShouldAnswerBatchWithCreatedPlanetsAndProblems(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, new(mock.SwapiClientMock), mockLogger)
+
+	zeltrosId, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+	kesselId, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994edf")
+	createdAt := time.Date(2020, 4, 27, 18, 30, 0, 0, time.UTC)
+
+	mongoMock.On("InsertMany", mock2.Anything).Run(func(args mock2.Arguments) {
+		planets := args.Get(0).([]*repository.Planet)
+		planets[0].Id = zeltrosId
+		planets[0].CreatedAt = &createdAt
+		planets[0].UpdatedAt = &createdAt
+		planets[0].Version = 1
+	}).Return([]error{nil, &repository.DuplicateError{Id: kesselId}})
+
+	r, _ := http.NewRequest("POST", "/v1/planets:batch", bytes.NewBufferString(`[
+		{"name":"Zeltros","weather":"temperate","land":"plains","source":"custom"},
+		{"name":"Yavin","source":"custom"},
+		{"name":"Kessel","weather":"arid","land":"barren","source":"custom"}
+	]`))
+
+	w := httptest.NewRecorder()
+
+	h.SavePlanets(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assertGolden(t, "planets-batch", w.Body.Bytes())
+}
+
+func TestShouldNotRecordBatchWithSwapiFailureForIdempotencyKey(t *testing.T) {
+	var unavailable *client.SwapiPlanet
+
+	repo := repository.NewMemory()
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	swapiMock.On("GetPlanetByName", "Tatooine").Return(unavailable,
+		&client.UpstreamError{Err: errors.New("swapi answered with status 503")}).Once()
+	swapiMock.On("GetPlanetByName", "Tatooine").Return(&client.SwapiPlanet{Results: []client.Results{{Name: "Tatooine",
+		Url: "https://swapi.dev/api/planets/1/"}}}, nil)
+	swapiMock.On("GetFilms", mock2.Anything).Return([]client.SwapiFilm{}, nil)
+
+	h := handler.NewPlanetHandler(repo, swapiMock, mockLogger)
+
+	body := `[{"name":"Zeltros","weather":"temperate","land":"plains","source":"custom"},` +
+		`{"name":"Tatooine","weather":"arid","land":"desert"}]`
+
+	post := func() (*httptest.ResponseRecorder, handler.BatchResponse) {
+		r, _ := http.NewRequest("POST", "/v1/planets:batch", bytes.NewBufferString(body))
+		r.Header.Set("Idempotency-Key", "create-batch")
+		w := httptest.NewRecorder()
+
+		h.SavePlanets(w, r)
+
+		var response handler.BatchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w, response
+	}
+
+	failed, failedResponse := post()
+	retried, retriedResponse := post()
+	replayed, replayedResponse := post()
+
+	assert.Equal(t, http.StatusOK, failed.Code)
+	assert.Equal(t, 201, failedResponse.Results[0].Status)
+	assert.Equal(t, 502, failedResponse.Results[1].Status)
+
+	assert.Empty(t, retried.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 409, retriedResponse.Results[0].Status)
+	assert.Equal(t, 201, retriedResponse.Results[1].Status)
+
+	assert.Equal(t, "true", replayed.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, retriedResponse, replayedResponse)
+
+	swapiMock.AssertNumberOfCalls(t, "GetPlanetByName", 2)
+}
+
+func TestShouldReturnBadRequestWhenBatchIsTooLarge(t *testing.T) {
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandlerWithConfig(repository.NewMemory(), new(mock.SwapiClientMock), mockLogger,
+		config.NewDefaultTimeoutConfig(), config.NewDefaultIdempotencyConfig(), config.BatchConfig{MaxSize: 1, Concurrency: 1})
+
+	for _, body := range []string{`[]`, `[{"name":"Hoth"},{"name":"Tatooine"}]`, `{"name":"Hoth"}`} {
+		r, _ := http.NewRequest("POST", "/v1/planets:batch", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+
+		h.SavePlanets(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestShouldRemovePlanetsMatchingFilterOnlyWhenConfirmed(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemory()
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(repo, new(mock.SwapiClientMock), mockLogger)
+
+	for _, planet := range []*repository.Planet{{Name: "Zeltros", Source: repository.SourceCustom},
+		{Name: "Kessel", Source: repository.SourceCustom}, {Name: "Tatooine", Source: repository.SourceSwapi}} {
+		_, err := repo.Save(ctx, planet)
+		require.NoError(t, err)
+	}
+
+	for _, query := range []string{"source=custom", "source=custom&confirm=yes", "source=custom&confirm=true&limit=1",
+		"sourc=custom&confirm=true"} {
+		r, _ := http.NewRequest("DELETE", "/v1/planets?"+query, nil)
+		w := httptest.NewRecorder()
+
+		h.RemovePlanets(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	r, _ := http.NewRequest("DELETE", "/v1/planets?source=custom&confirm=true", nil)
+	w := httptest.NewRecorder()
+
+	h.RemovePlanets(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assertGolden(t, "planets-bulk-deleted", w.Body.Bytes())
+
+	planets, _ := repo.FindAll(ctx, repository.Filter{})
+	require.Len(t, *planets, 1)
+	assert.Equal(t, "Tatooine", (*planets)[0].Name)
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files with the payloads the handlers send")
+
+// assertGolden compares the JSON payload, indented, with testdata/<name>.json. Run the tests with -update to
+// rewrite the files after changing a payload on purpose.
+func assertGolden(t *testing.T, name string, payload []byte) {
+	t.Helper()
+
+	var indented bytes.Buffer
+	require.NoError(t, json.Indent(&indented, payload, "", "  "))
+	indented.WriteByte('\n')
+
+	path := filepath.Join("testdata", name+".json")
+
+	if *updateGolden {
+		require.NoError(t, ioutil.WriteFile(path, indented.Bytes(), 0644))
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, string(expected), indented.String())
+}
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
 	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/client"
 	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/handler"
 	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
@@ -11,10 +13,14 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	mock2 "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestShouldGetPlanetByIdWithSuccess(t *testing.T) {
@@ -24,9 +30,12 @@ func TestShouldGetPlanetByIdWithSuccess(t *testing.T) {
 
 	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
 
-	returnedPlanet := repository.Planet{Name: "Aldebaran", Land: "Dry", Weather: "Dry", AppearanceQuantity: 2}
-
 	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+	createdAt := time.Date(2020, 4, 27, 18, 30, 0, 0, time.UTC)
+	updatedAt := time.Date(2020, 5, 2, 9, 15, 0, 0, time.UTC)
+
+	returnedPlanet := repository.Planet{Id: id, Name: "Aldebaran", Land: "Dry", Weather: "Dry", AppearanceQuantity: 2,
+		Source: repository.SourceSwapi, CreatedAt: &createdAt, UpdatedAt: &updatedAt}
 
 	mongoMock.On("FindById", id).Return(&returnedPlanet, nil)
 
@@ -42,7 +51,8 @@ func TestShouldGetPlanetByIdWithSuccess(t *testing.T) {
 	h.GetPlanetById(w, r)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, "{\"Name\":\"Aldebaran\",\"Weather\":\"Dry\",\"Land\":\"Dry\",\"AppearanceQuantity\":2}", w.Body.String())
+	assert.Equal(t, "application/vnd.starwars-planets.v1+json", w.Header().Get("Content-Type"))
+	assertGolden(t, "planet", w.Body.Bytes())
 }
 
 func TestShouldGetPlanetByIdReturnBadRequestInvalidId(t *testing.T) {
@@ -69,7 +79,7 @@ func TestShouldGetPlanetByIdReturnBadRequestInvalidId(t *testing.T) {
 	mongoMock.AssertNumberOfCalls(t, "FindById", 0)
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Equal(t, "{\"description\":\"planet id is not a valid id\"}", w.Body.String())
+	assert.Equal(t, "{\"type\":\"/problems/invalid-request\",\"title\":\"Invalid request\",\"status\":400,\"detail\":\"planet id is not a valid id\"}", w.Body.String())
 }
 
 func TestShouldGetPlanetByIdReturnInternalServerErrorWhenProblemWithRepository(t *testing.T) {
@@ -99,7 +109,37 @@ func TestShouldGetPlanetByIdReturnInternalServerErrorWhenProblemWithRepository(t
 	mockLogger.AssertNumberOfCalls(t, "LogWithFields", 1)
 
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "{\"description\":\"error on repository\"}", w.Body.String())
+	assert.Equal(t, "{\"type\":\"/problems/internal-error\",\"title\":\"Internal server error\",\"status\":500,\"detail\":\"an unexpected error occurred\"}", w.Body.String())
+}
+
+func TestShouldGetPlanetByIdReturnNotFoundWhenPlanetDoesNotExist(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	var emptyResponse *repository.Planet
+
+	mongoMock.On("FindById", id).Return(emptyResponse, repository.ErrNotFound)
+
+	r, _ := http.NewRequest("GET", "/v1/planets/5ea7208049e00ddb76994ede", nil)
+	r.Header.Set("X-Request-Id", "request-1")
+	w := httptest.NewRecorder()
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	h.GetPlanetById(w, r)
+
+	mockLogger.AssertNumberOfCalls(t, "LogWithFields", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "{\"type\":\"/problems/planet-not-found\",\"title\":\"Planet not found\",\"status\":404,"+
+		"\"detail\":\"there is no planet with the requested id\",\"instance\":\"request-1\"}", w.Body.String())
 }
 
 func TestShouldReturnAllPlanetsWithoutFilter(t *testing.T) {
@@ -109,10 +149,14 @@ func TestShouldReturnAllPlanetsWithoutFilter(t *testing.T) {
 
 	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
 
-	returnedPlanets := []repository.Planet{{Name: "Aldebaran", Land: "Dry", Weather: "Dry", AppearanceQuantity: 2},
-		{Name: "Tattoine", Land: "Dry", Weather: "Dry", AppearanceQuantity: 1}}
+	aldebaranId, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+	tattoineId, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994edf")
+
+	returnedPlanets := []repository.Planet{{Id: aldebaranId, Name: "Aldebaran", Land: "Dry", Weather: "Dry", AppearanceQuantity: 2},
+		{Id: tattoineId, Name: "Tattoine", Land: "Dry", Weather: "Dry", AppearanceQuantity: 1, Source: repository.SourceCustom}}
 
-	mongoMock.On("FindAll", repository.Filter{}).Return(&returnedPlanets, nil)
+	mongoMock.On("FindAll", repository.Filter{Limit: 20}).Return(&returnedPlanets, nil)
+	mongoMock.On("Count", repository.Filter{Limit: 20}).Return(int64(2), nil)
 
 	r, _ := http.NewRequest("GET", "/v1/planets", nil)
 	w := httptest.NewRecorder()
@@ -120,8 +164,7 @@ func TestShouldReturnAllPlanetsWithoutFilter(t *testing.T) {
 	h.GetPlanets(w, r)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, "[{\"Name\":\"Aldebaran\",\"Weather\":\"Dry\",\"Land\":\"Dry\",\"AppearanceQuantity\":2},"+
-		"{\"Name\":\"Tattoine\",\"Weather\":\"Dry\",\"Land\":\"Dry\",\"AppearanceQuantity\":1}]", w.Body.String())
+	assertGolden(t, "planets-page", w.Body.Bytes())
 }
 
 func TestShouldReturnAllPlanetsWithoutFilterEmptyList(t *testing.T) {
@@ -133,7 +176,8 @@ func TestShouldReturnAllPlanetsWithoutFilterEmptyList(t *testing.T) {
 
 	returnedPlanets := make([]repository.Planet, 0)
 
-	mongoMock.On("FindAll", repository.Filter{}).Return(&returnedPlanets, nil)
+	mongoMock.On("FindAll", repository.Filter{Limit: 20}).Return(&returnedPlanets, nil)
+	mongoMock.On("Count", repository.Filter{Limit: 20}).Return(int64(0), nil)
 
 	r, _ := http.NewRequest("GET", "/v1/planets", nil)
 	w := httptest.NewRecorder()
@@ -141,7 +185,7 @@ func TestShouldReturnAllPlanetsWithoutFilterEmptyList(t *testing.T) {
 	h.GetPlanets(w, r)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, "[]", w.Body.String())
+	assert.Equal(t, "{\"total\":0,\"limit\":20,\"results\":[],\"links\":{}}", w.Body.String())
 }
 
 func TestShouldReturnAllPlanetsWithFilter(t *testing.T) {
@@ -151,9 +195,12 @@ func TestShouldReturnAllPlanetsWithFilter(t *testing.T) {
 
 	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
 
-	returnedPlanets := []repository.Planet{{Name: "Aldebaran", Land: "Dry", Weather: "Dry", AppearanceQuantity: 2}}
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	returnedPlanets := []repository.Planet{{Id: id, Name: "Aldebaran", Land: "Dry", Weather: "Dry", AppearanceQuantity: 2}}
 
-	mongoMock.On("FindAll", repository.Filter{Name: "Aldebaran"}).Return(&returnedPlanets, nil)
+	mongoMock.On("FindAll", repository.Filter{Name: "Aldebaran", Limit: 20}).Return(&returnedPlanets, nil)
+	mongoMock.On("Count", repository.Filter{Name: "Aldebaran", Limit: 20}).Return(int64(1), nil)
 
 	r, _ := http.NewRequest("GET", "/v1/planets?name=Aldebaran", nil)
 
@@ -162,7 +209,205 @@ func TestShouldReturnAllPlanetsWithFilter(t *testing.T) {
 	h.GetPlanets(w, r)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, "[{\"Name\":\"Aldebaran\",\"Weather\":\"Dry\",\"Land\":\"Dry\",\"AppearanceQuantity\":2}]", w.Body.String())
+	assertGolden(t, "planets-page-filtered", w.Body.Bytes())
+}
+
+func TestShouldReturnAllPlanetsWithRichFilter(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	returnedPlanets := []repository.Planet{{Name: "Aldebaran", Land: "Dry", Weather: "Arid", AppearanceQuantity: 2}}
+
+	minAppearances := 2
+	filter := repository.Filter{
+		NamePrefix:            "ald",
+		Weather:               []string{"arid", "temperate", "frozen"},
+		Land:                  []string{"Dry"},
+		AppearanceQuantityGte: &minAppearances,
+		Limit:                 20,
+	}
+
+	mongoMock.On("FindAll", filter).Return(&returnedPlanets, nil)
+	mongoMock.On("Count", filter).Return(int64(1), nil)
+
+	r, _ := http.NewRequest("GET",
+		"/v1/planets?name[prefix]=ald&weather=arid,%20temperate&weather=frozen&land=Dry&appearanceQuantity[gte]=2", nil)
+
+	w := httptest.NewRecorder()
+
+	h.GetPlanets(w, r)
+
+	mongoMock.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestShouldReturnAllPlanetsWithSwapiFilter(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	returnedPlanets := make([]repository.Planet, 0)
+
+	minPopulation := int64(1000)
+	maxDiameter := int64(12000)
+	minResidents := 2
+	filter := repository.Filter{
+		Source:        repository.SourceSwapi,
+		Film:          []string{"A New Hope"},
+		MinResidents:  &minResidents,
+		Climate:       []string{"arid", "temperate"},
+		Terrain:       []string{"desert"},
+		PopulationGte: &minPopulation,
+		DiameterLte:   &maxDiameter,
+		Limit:         20,
+	}
+
+	mongoMock.On("FindAll", filter).Return(&returnedPlanets, nil)
+	mongoMock.On("Count", filter).Return(int64(0), nil)
+
+	r, _ := http.NewRequest("GET", "/v1/planets?source=swapi&film=A%20New%20Hope&minResidents=2&climate=arid,temperate&terrain=desert&population[gte]=1000&diameter[lte]=12000", nil)
+
+	w := httptest.NewRecorder()
+
+	h.GetPlanets(w, r)
+
+	mongoMock.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestShouldReturnBadRequestWhenFilterIsInvalid(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	for _, query := range []string{
+		"appearanceQuantity[gte]=two",
+		"appearanceQuantity[gt]=-1",
+		"appearanceQuantity[gte]=5&appearanceQuantity[lt]=2",
+		"name[contains]=" + strings.Repeat("a", 101),
+		"population[gte]=-1",
+		"diameter[gte]=10000&diameter[lte]=100",
+		"minResidents=-1",
+		"source=fanon",
+		"climat=arid",
+	} {
+		r, _ := http.NewRequest("GET", "/v1/planets?"+query, nil)
+
+		w := httptest.NewRecorder()
+
+		h.GetPlanets(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	mongoMock.AssertNumberOfCalls(t, "FindAll", 0)
+}
+
+func TestShouldReturnBadRequestWhenQueryParameterIsUnknown(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, new(mock.SwapiClientMock), mockLogger)
+
+	r, _ := http.NewRequest("GET", "/v1/planets?climate=arid&climat=arid", nil)
+
+	w := httptest.NewRecorder()
+
+	h.GetPlanets(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "{\"type\":\"/problems/invalid-request\",\"title\":\"Invalid request\",\"status\":400,\"detail\":\"unknown query parameter climat\"}", w.Body.String())
+	mongoMock.AssertNumberOfCalls(t, "FindAll", 0)
+}
+
+func TestShouldReturnPlanetsPageWithOffsetLinks(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994edf")
+
+	returnedPlanets := []repository.Planet{{Id: id, Name: "Tattoine", Land: "Dry", Weather: "Dry", AppearanceQuantity: 5}}
+
+	filter := repository.Filter{Sort: "-appearanceQuantity", Limit: 1, Offset: 1}
+
+	mongoMock.On("FindAll", filter).Return(&returnedPlanets, nil)
+	mongoMock.On("Count", filter).Return(int64(3), nil)
+
+	r, _ := http.NewRequest("GET", "/v1/planets?sort=-appearanceQuantity&limit=1&offset=1", nil)
+
+	w := httptest.NewRecorder()
+
+	h.GetPlanets(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assertGolden(t, "planets-page-with-offset-links", w.Body.Bytes())
+}
+
+func TestShouldReturnPlanetsPageWithCursorLinks(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	firstId, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994edf")
+	lastId, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ee0")
+
+	returnedPlanets := []repository.Planet{{Id: firstId, Name: "Aldebaran"}, {Id: lastId, Name: "Tattoine"}}
+
+	filter := repository.Filter{Limit: 2, After: "5ea7208049e00ddb76994ede"}
+
+	mongoMock.On("FindAll", filter).Return(&returnedPlanets, nil)
+	mongoMock.On("Count", filter).Return(int64(5), nil)
+
+	r, _ := http.NewRequest("GET", "/v1/planets?limit=2&after=5ea7208049e00ddb76994ede", nil)
+
+	w := httptest.NewRecorder()
+
+	h.GetPlanets(w, r)
+
+	var page handler.PlanetPage
+
+	_ = json.Unmarshal(w.Body.Bytes(), &page)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(5), page.Total)
+	assert.Equal(t, 2, len(page.Results))
+	assert.Equal(t, "/v1/planets?after=5ea7208049e00ddb76994ee0&limit=2", page.Links.Next)
+	assert.Equal(t, "/v1/planets?before=5ea7208049e00ddb76994edf&limit=2", page.Links.Prev)
+}
+
+func TestShouldReturnBadRequestWhenPaginationIsInvalid(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	for _, query := range []string{"limit=abc", "limit=-1", "limit=101", "sort=weather", "after=123", "sort=name&after=5ea7208049e00ddb76994ede"} {
+		r, _ := http.NewRequest("GET", "/v1/planets?"+query, nil)
+
+		w := httptest.NewRecorder()
+
+		h.GetPlanets(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	mongoMock.AssertNumberOfCalls(t, "FindAll", 0)
 }
 
 func TestShouldRemovePlanetByIdWithSuccess(t *testing.T) {
@@ -191,6 +436,30 @@ func TestShouldRemovePlanetByIdWithSuccess(t *testing.T) {
 	assert.Equal(t, http.StatusNoContent, w.Code)
 }
 
+func TestShouldReturnNotFoundWhenDeletingPlanetThatDoesNotExist(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	mongoMock.On("Delete", id).Return(repository.ErrNotFound)
+
+	r, _ := http.NewRequest("DELETE", "/v1/planets/5ea7208049e00ddb76994ede", nil)
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.RemovePlanetById(w, r)
+
+	mockLogger.AssertNumberOfCalls(t, "LogWithFields", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
 func TestShouldReturnBadRequestDeletePlanetInvalidId(t *testing.T) {
 	mongoMock := new(mock.MongoMock)
 	swapiMock := new(mock.SwapiClientMock)
@@ -215,7 +484,7 @@ func TestShouldReturnBadRequestDeletePlanetInvalidId(t *testing.T) {
 	mongoMock.AssertNumberOfCalls(t, "Delete", 0)
 	mockLogger.AssertNumberOfCalls(t, "LogWithFields", 1)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Equal(t, "{\"description\":\"planet id is not a valid id\"}", w.Body.String())
+	assert.Equal(t, "{\"type\":\"/problems/invalid-request\",\"title\":\"Invalid request\",\"status\":400,\"detail\":\"planet id is not a valid id\"}", w.Body.String())
 }
 
 func TestShouldReturnInternalServerErrorWhenThereIsErrorOnRepostioryWhenDeleting(t *testing.T) {
@@ -244,7 +513,7 @@ func TestShouldReturnInternalServerErrorWhenThereIsErrorOnRepostioryWhenDeleting
 
 	mockLogger.AssertNumberOfCalls(t, "LogWithFields", 1)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "{\"description\":\"error on repository\"}", w.Body.String())
+	assert.Equal(t, "{\"type\":\"/problems/internal-error\",\"title\":\"Internal server error\",\"status\":500,\"detail\":\"an unexpected error occurred\"}", w.Body.String())
 }
 
 func TestShouldReturnCreatedWhenCreatePlanetWithSuccess(t *testing.T) {
@@ -260,11 +529,15 @@ func TestShouldReturnCreatedWhenCreatePlanetWithSuccess(t *testing.T) {
 	films = append(films, "film 1")
 	films = append(films, "film 2")
 
-	swapiResponse := client.SwapiPlanet{Results: []client.Results{{Films: films}}}
-	savedPlanet := repository.Planet{Id: id}
+	createdAt := time.Date(2020, 4, 27, 18, 30, 0, 0, time.UTC)
+
+	swapiResponse := client.SwapiPlanet{Results: []client.Results{{Name: "Aldebaran", Films: films}}}
+	savedPlanet := repository.Planet{Id: id, Name: "Aldebaran", Land: "dessert", Weather: "rain", AppearanceQuantity: 2,
+		Source: repository.SourceSwapi, CreatedAt: &createdAt, UpdatedAt: &createdAt}
 
 	mongoMock.On("Save", mock2.Anything).Return(&savedPlanet, nil)
 	swapiMock.On("GetPlanetByName", "Aldebaran").Return(&swapiResponse, nil)
+	swapiMock.On("GetFilms", mock2.Anything).Return([]client.SwapiFilm{}, nil)
 
 	planetRequest := handler.PlanetRequest{Name: "Aldebaran", Land: "dessert", Weather: "rain"}
 
@@ -279,7 +552,112 @@ func TestShouldReturnCreatedWhenCreatePlanetWithSuccess(t *testing.T) {
 	h.SavePlanet(w, r)
 
 	assert.Equal(t, http.StatusCreated, w.Code)
-	assert.Equal(t, "v1/planets/5ea7208049e00ddb76994ede", w.Header().Get("Location"))
+	assert.Equal(t, "/v1/planets/5ea7208049e00ddb76994ede", w.Header().Get("Location"))
+	assertGolden(t, "planet-created", w.Body.Bytes())
+}
+
+func TestShouldCreatePlanetWithoutBodyWhenMinimalReturnIsPreferred(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	mongoMock.On("Save", mock2.Anything).Return(&repository.Planet{Id: id, Name: "Zeltros"}, nil)
+
+	r, _ := http.NewRequest("POST", "/v1/planets",
+		bytes.NewBufferString(`{"name":"Zeltros","weather":"temperate","land":"plains","source":"custom"}`))
+	r.Header.Set("Prefer", "handling=strict, return=minimal")
+
+	w := httptest.NewRecorder()
+
+	h.SavePlanet(w, r)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/v1/planets/5ea7208049e00ddb76994ede", w.Header().Get("Location"))
+	assert.Equal(t, "return=minimal", w.Header().Get("Preference-Applied"))
+	assert.Empty(t, w.Body.String())
+}
+
+func TestShouldReturnBadRequestWhenCreatingPlanetWithMalformedBody(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	for _, body := range []string{
+		`{"name":`,
+		`{"name":"Hoth","population":10}`,
+		`{"name":"Hoth"}{"name":"Tatooine"}`,
+		`{"name":"` + strings.Repeat("a", 1<<14) + `"}`,
+	} {
+		r, _ := http.NewRequest("POST", "/v1/planets", bytes.NewBufferString(body))
+
+		w := httptest.NewRecorder()
+
+		h.SavePlanet(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	swapiMock.AssertNumberOfCalls(t, "GetPlanetByName", 0)
+}
+
+func TestShouldReturnUnprocessableEntityWhenCreatingInvalidPlanet(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	planetRequest := handler.PlanetRequest{Name: "", Land: strings.Repeat("a", 101), Weather: "rain; drop table"}
+
+	reqBodyBytes := new(bytes.Buffer)
+
+	_ = json.NewEncoder(reqBodyBytes).Encode(planetRequest)
+
+	r, _ := http.NewRequest("POST", "/v1/planets", reqBodyBytes)
+
+	w := httptest.NewRecorder()
+
+	h.SavePlanet(w, r)
+
+	swapiMock.AssertNumberOfCalls(t, "GetPlanetByName", 0)
+	mockLogger.AssertNumberOfCalls(t, "LogWithFields", 1)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "{\"type\":\"/problems/invalid-planet\",\"title\":\"Invalid planet\",\"status\":422,"+
+		"\"detail\":\"one or more fields are not valid\",\"errors\":["+
+		"{\"field\":\"name\",\"message\":\"is required\"},"+
+		"{\"field\":\"weather\",\"message\":\"contains invalid characters\"},"+
+		"{\"field\":\"land\",\"message\":\"must have at most 100 characters\"}]}", w.Body.String())
+}
+
+func TestShouldAcceptPlanetNamesWithSpacesAndDigits(t *testing.T) {
+	for _, name := range []string{"Yavin IV", "Mon Cala", "Ord Mantell", "Tund", "Zolan-3"} {
+		assert.Nil(t, handler.PlanetRequest{Name: name, Weather: "temperate, tropical", Land: "jungle"}.Validate(), name)
+	}
+
+	for _, name := range []string{" Hoth", "Hoth ", "<script>", "Hoth\n"} {
+		assert.NotNil(t, handler.PlanetRequest{Name: name}.Validate(), name)
+	}
+}
+
+func TestShouldRequireWeatherAndLandOfCustomPlanets(t *testing.T) {
+	assert.Nil(t, handler.PlanetRequest{Name: "Hoth", Source: repository.SourceSwapi}.Validate())
+	assert.Nil(t, handler.PlanetRequest{Name: "Zeltros", Weather: "temperate", Land: "plains", Source: repository.SourceCustom}.Validate())
+
+	assert.Equal(t, []handler.FieldError{
+		{Field: "weather", Message: "is required for custom planets"},
+		{Field: "land", Message: "is required for custom planets"},
+	}, handler.PlanetRequest{Name: "Zeltros", Source: repository.SourceCustom}.Validate())
+
+	assert.Equal(t, []handler.FieldError{{Field: "source", Message: "must be swapi or custom"}},
+		handler.PlanetRequest{Name: "Zeltros", Source: "fanon"}.Validate())
 }
 
 func TestShouldReturnNotFoundWhenPlanetNotExist(t *testing.T) {
@@ -341,10 +719,10 @@ func TestShouldReturnServerErrorWhenThereIsAnErrorCallingClient(t *testing.T) {
 	mongoMock.AssertNumberOfCalls(t, "Save", 0)
 	mockLogger.AssertNumberOfCalls(t, "LogWithFields", 1)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "{\"description\":\"error calling client\"}", w.Body.String())
+	assert.Equal(t, "{\"type\":\"/problems/internal-error\",\"title\":\"Internal server error\",\"status\":500,\"detail\":\"an unexpected error occurred\"}", w.Body.String())
 }
 
-func TestShouldReturnServerErrorWhenThereIsAnErrorCallingRepository(t *testing.T) {
+func TestShouldReturnServiceUnavailableWhenSwapiCircuitIsOpen(t *testing.T) {
 	mongoMock := new(mock.MongoMock)
 	swapiMock := new(mock.SwapiClientMock)
 	mockLogger := new(mock.LoggerMock)
@@ -352,29 +730,1180 @@ func TestShouldReturnServerErrorWhenThereIsAnErrorCallingRepository(t *testing.T
 
 	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
 
-	films := make([]string, 0)
-	films = append(films, "film 1")
-	films = append(films, "film 2")
+	var swapi *client.SwapiPlanet
 
-	var emptyResponse *repository.Planet
-	swapiResponse := client.SwapiPlanet{Results: []client.Results{{Films: films}}}
+	swapiMock.On("GetPlanetByName", "Aldebaran").Return(swapi, &client.CircuitOpenError{RetryAfter: 30 * time.Second})
 
-	swapiMock.On("GetPlanetByName", "Aldebaran").Return(&swapiResponse, nil)
-	mongoMock.On("Save", mock2.Anything).Return(emptyResponse, errors.New("error on repository"))
+	r, _ := http.NewRequest("POST", "/v1/planets", bytes.NewBufferString(`{"name":"Aldebaran","weather":"rain","land":"dessert"}`))
 
-	planetRequest := handler.PlanetRequest{Name: "Aldebaran", Land: "dessert", Weather: "rain"}
+	w := httptest.NewRecorder()
 
-	reqBodyBytes := new(bytes.Buffer)
+	h.SavePlanet(w, r)
 
-	_ = json.NewEncoder(reqBodyBytes).Encode(planetRequest)
+	mongoMock.AssertNumberOfCalls(t, "Save", 0)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "{\"type\":\"/problems/swapi-unavailable\",\"title\":\"SWAPI unavailable\",\"status\":503,\"detail\":\"SWAPI keeps failing, so planets cannot be looked up for now, retry later\"}", w.Body.String())
+}
 
-	r, _ := http.NewRequest("POST", "/v1/planets", reqBodyBytes)
+func TestShouldReturnBadGatewayWhenSwapiFails(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	var swapi *client.SwapiPlanet
+
+	swapiMock.On("GetPlanetByName", "Aldebaran").Return(swapi,
+		&client.UpstreamError{Err: errors.New("swapi answered with status 503")})
+
+	r, _ := http.NewRequest("POST", "/v1/planets", bytes.NewBufferString(`{"name":"Aldebaran","weather":"rain","land":"dessert"}`))
 
 	w := httptest.NewRecorder()
 
 	h.SavePlanet(w, r)
 
-	mockLogger.AssertNumberOfCalls(t, "LogWithFields", 1)
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "{\"description\":\"error on repository\"}", w.Body.String())
+	mongoMock.AssertNumberOfCalls(t, "Save", 0)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Empty(t, w.Header().Get("Retry-After"))
+	assert.Equal(t, "{\"type\":\"/problems/swapi-error\",\"title\":\"SWAPI error\",\"status\":502,\"detail\":\"SWAPI could not answer the lookup\"}", w.Body.String())
+}
+
+func TestShouldReturnServerErrorWhenThereIsAnErrorCallingRepository(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	films := make([]string, 0)
+	films = append(films, "film 1")
+	films = append(films, "film 2")
+
+	var emptyResponse *repository.Planet
+	swapiResponse := client.SwapiPlanet{Results: []client.Results{{Name: "Aldebaran", Films: films}}}
+
+	swapiMock.On("GetPlanetByName", "Aldebaran").Return(&swapiResponse, nil)
+	swapiMock.On("GetFilms", mock2.Anything).Return([]client.SwapiFilm{}, nil)
+	mongoMock.On("Save", mock2.Anything).Return(emptyResponse, errors.New("error on repository"))
+
+	planetRequest := handler.PlanetRequest{Name: "Aldebaran", Land: "dessert", Weather: "rain"}
+
+	reqBodyBytes := new(bytes.Buffer)
+
+	_ = json.NewEncoder(reqBodyBytes).Encode(planetRequest)
+
+	r, _ := http.NewRequest("POST", "/v1/planets", reqBodyBytes)
+
+	w := httptest.NewRecorder()
+
+	h.SavePlanet(w, r)
+
+	mockLogger.AssertNumberOfCalls(t, "LogWithFields", 1)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "{\"type\":\"/problems/internal-error\",\"title\":\"Internal server error\",\"status\":500,\"detail\":\"an unexpected error occurred\"}", w.Body.String())
+}
+
+func TestShouldUpdatePlanetWithSuccess(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	storedPlanet := repository.Planet{Id: id, Name: "Aldebaran", Land: "Dry", Weather: "Dry", AppearanceQuantity: 2}
+	updatedPlanet := repository.Planet{Id: id, Name: "Aldebaran", Land: "dessert", Weather: "rain", AppearanceQuantity: 2,
+		Source: repository.SourceSwapi}
+
+	mongoMock.On("FindById", id).Return(&storedPlanet, nil)
+	mongoMock.On("Update", &updatedPlanet).Return(&updatedPlanet, nil)
+
+	planetRequest := handler.PlanetRequest{Name: "Aldebaran", Land: "dessert", Weather: "rain"}
+
+	reqBodyBytes := new(bytes.Buffer)
+
+	_ = json.NewEncoder(reqBodyBytes).Encode(planetRequest)
+
+	r, _ := http.NewRequest("PUT", "/v1/planets/5ea7208049e00ddb76994ede", reqBodyBytes)
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.UpdatePlanet(w, r)
+
+	swapiMock.AssertNumberOfCalls(t, "GetPlanetByName", 0)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assertGolden(t, "planet-updated", w.Body.Bytes())
+}
+
+func TestShouldUpdatePlanetRecomputeAppearancesWhenNameChanges(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	storedPlanet := repository.Planet{Id: id, Name: "Aldebaran", Land: "Dry", Weather: "Dry", AppearanceQuantity: 2}
+	diameter := int64(10465)
+	gravity := 1.0
+	updatedPlanet := repository.Planet{Id: id, Name: "Tatooine", Land: "dessert", Weather: "arid", AppearanceQuantity: 5,
+		Source: repository.SourceSwapi, Swapi: &repository.SwapiData{Url: "https://swapi.dev/api/planets/1/", Diameter: &diameter, Gravity: &gravity,
+			Climate: []string{"arid", "hot"}, Terrain: []string{"desert"}, Residents: []string{}, Films: []string{"1", "2", "3", "4", "5"}},
+		Films: []repository.Film{}}
+
+	swapiResponse := client.SwapiPlanet{Results: []client.Results{{Name: "Tatooine", Diameter: "10465", Gravity: "1 standard",
+		Population: "unknown", Climate: "arid, hot", Terrain: "desert", Url: "https://swapi.dev/api/planets/1/",
+		Films: []string{"1", "2", "3", "4", "5"}}}}
+
+	mongoMock.On("FindById", id).Return(&storedPlanet, nil)
+	mongoMock.On("Update", mock2.MatchedBy(func(planet *repository.Planet) bool {
+		synced := *planet
+		synced.SyncedAt = nil
+		return planet.SyncedAt != nil && assert.ObjectsAreEqual(updatedPlanet, synced)
+	})).Return(&updatedPlanet, nil)
+	swapiMock.On("GetPlanetByName", "Tatooine").Return(&swapiResponse, nil)
+	swapiMock.On("GetFilms", mock2.Anything).Return([]client.SwapiFilm{}, nil)
+
+	r, _ := http.NewRequest("PUT", "/v1/planets/5ea7208049e00ddb76994ede",
+		bytes.NewBufferString(`{"name":"Tatooine","weather":"arid","land":"dessert"}`))
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.UpdatePlanet(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assertGolden(t, "planet-updated-from-swapi", w.Body.Bytes())
+}
+
+func TestShouldReturnNotFoundWhenUpdatingPlanetThatDoesNotExist(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	var emptyResponse *repository.Planet
+
+	mongoMock.On("FindById", id).Return(emptyResponse, repository.ErrNotFound)
+
+	r, _ := http.NewRequest("PUT", "/v1/planets/5ea7208049e00ddb76994ede",
+		bytes.NewBufferString(`{"name":"Aldebaran","weather":"rain","land":"dessert"}`))
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.UpdatePlanet(w, r)
+
+	mongoMock.AssertNumberOfCalls(t, "Update", 0)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestShouldReturnNotFoundWhenPlanetIsRemovedBeforeUpdate(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	var emptyResponse *repository.Planet
+	storedPlanet := repository.Planet{Id: id, Name: "Aldebaran", Land: "Dry", Weather: "Dry", AppearanceQuantity: 2}
+
+	mongoMock.On("FindById", id).Return(&storedPlanet, nil)
+	mongoMock.On("Update", mock2.Anything).Return(emptyResponse, repository.ErrNotFound)
+
+	r, _ := http.NewRequest("PUT", "/v1/planets/5ea7208049e00ddb76994ede",
+		bytes.NewBufferString(`{"name":"Aldebaran","weather":"rain","land":"dessert"}`))
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.UpdatePlanet(w, r)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestShouldReturnBadRequestWhenUpdatingWithInvalidBody(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	r, _ := http.NewRequest("PUT", "/v1/planets/5ea7208049e00ddb76994ede", bytes.NewBufferString(`{"name":`))
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.UpdatePlanet(w, r)
+
+	mongoMock.AssertNumberOfCalls(t, "FindById", 0)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "{\"type\":\"/problems/invalid-request\",\"title\":\"Invalid request\",\"status\":400,\"detail\":\"request body is not a valid planet: unexpected EOF\"}", w.Body.String())
+}
+
+func TestShouldReturnInternalServerErrorWhenThereIsErrorOnRepositoryWhenUpdating(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	var emptyResponse *repository.Planet
+	storedPlanet := repository.Planet{Id: id, Name: "Aldebaran", Land: "Dry", Weather: "Dry", AppearanceQuantity: 2}
+
+	mongoMock.On("FindById", id).Return(&storedPlanet, nil)
+	mongoMock.On("Update", mock2.Anything).Return(emptyResponse, errors.New("error on repository"))
+
+	r, _ := http.NewRequest("PUT", "/v1/planets/5ea7208049e00ddb76994ede",
+		bytes.NewBufferString(`{"name":"Aldebaran","weather":"rain","land":"dessert"}`))
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.UpdatePlanet(w, r)
+
+	mockLogger.AssertNumberOfCalls(t, "LogWithFields", 1)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "{\"type\":\"/problems/internal-error\",\"title\":\"Internal server error\",\"status\":500,\"detail\":\"an unexpected error occurred\"}", w.Body.String())
+}
+
+func TestShouldPatchPlanetWithSuccess(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	storedPlanet := repository.Planet{Id: id, Name: "Aldebaran", Land: "Dry", Weather: "Dry", AppearanceQuantity: 2}
+	patchedPlanet := repository.Planet{Id: id, Name: "Aldebaran", Land: "", Weather: "rain", AppearanceQuantity: 2,
+		Source: repository.SourceSwapi}
+
+	mongoMock.On("FindById", id).Return(&storedPlanet, nil)
+	mongoMock.On("Update", &patchedPlanet).Return(&patchedPlanet, nil)
+
+	r, _ := http.NewRequest("PATCH", "/v1/planets/5ea7208049e00ddb76994ede",
+		bytes.NewBufferString(`{"weather":"rain","land":null}`))
+
+	r.Header.Set("Content-Type", "application/merge-patch+json")
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.PatchPlanet(w, r)
+
+	swapiMock.AssertNumberOfCalls(t, "GetPlanetByName", 0)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assertGolden(t, "planet-patched", w.Body.Bytes())
+}
+
+func TestShouldReturnUnprocessableEntityWhenPatchRemovesName(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	storedPlanet := repository.Planet{Id: id, Name: "Aldebaran", Land: "Dry", Weather: "Dry", AppearanceQuantity: 2}
+
+	mongoMock.On("FindById", id).Return(&storedPlanet, nil)
+
+	r, _ := http.NewRequest("PATCH", "/v1/planets/5ea7208049e00ddb76994ede", bytes.NewBufferString(`{"name":null}`))
+
+	r.Header.Set("Content-Type", "application/merge-patch+json")
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.PatchPlanet(w, r)
+
+	mongoMock.AssertNumberOfCalls(t, "Update", 0)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "{\"type\":\"/problems/invalid-planet\",\"title\":\"Invalid planet\",\"status\":422,\"detail\":\"one or more fields are not valid\",\"errors\":[{\"field\":\"name\",\"message\":\"is required\"}]}", w.Body.String())
+}
+
+func TestShouldReturnNotFoundWhenPatchingPlanetThatDoesNotExist(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	var emptyResponse *repository.Planet
+
+	mongoMock.On("FindById", id).Return(emptyResponse, repository.ErrNotFound)
+
+	r, _ := http.NewRequest("PATCH", "/v1/planets/5ea7208049e00ddb76994ede", bytes.NewBufferString(`{"weather":"rain"}`))
+
+	r.Header.Set("Content-Type", "application/merge-patch+json")
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.PatchPlanet(w, r)
+
+	mongoMock.AssertNumberOfCalls(t, "Update", 0)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestShouldReturnBadRequestWhenPatchIsNotAnObject(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	r, _ := http.NewRequest("PATCH", "/v1/planets/5ea7208049e00ddb76994ede", bytes.NewBufferString(`["rain"]`))
+
+	r.Header.Set("Content-Type", "application/merge-patch+json")
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.PatchPlanet(w, r)
+
+	mongoMock.AssertNumberOfCalls(t, "FindById", 0)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "{\"type\":\"/problems/invalid-request\",\"title\":\"Invalid request\",\"status\":400,\"detail\":\"request body is not a valid merge patch\"}", w.Body.String())
+}
+
+func TestShouldReturnConflictWhenCreatingDuplicatePlanet(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	swapiResponse := client.SwapiPlanet{Results: []client.Results{{Name: "Tatooine", Films: []string{"film 1"}}}}
+
+	var emptyResponse *repository.Planet
+
+	swapiMock.On("GetPlanetByName", "tatooine").Return(&swapiResponse, nil)
+	swapiMock.On("GetFilms", mock2.Anything).Return([]client.SwapiFilm{}, nil)
+	mongoMock.On("Save", mock2.Anything).Return(emptyResponse, &repository.DuplicateError{Id: id})
+
+	r, _ := http.NewRequest("POST", "/v1/planets", bytes.NewBufferString(`{"name":"tatooine","weather":"arid","land":"desert"}`))
+
+	w := httptest.NewRecorder()
+
+	h.SavePlanet(w, r)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "/v1/planets/5ea7208049e00ddb76994ede", w.Header().Get("Location"))
+	assert.Equal(t, "{\"type\":\"/problems/duplicate-planet\",\"title\":\"Planet already exists\",\"status\":409,\"detail\":\"another planet already has this name\"}", w.Body.String())
+}
+
+func TestShouldReturnConflictWhenRenamingPlanetToExistingName(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+	existingId, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994edf")
+
+	storedPlanet := repository.Planet{Id: id, Name: "Hoth", AppearanceQuantity: 1}
+	swapiResponse := client.SwapiPlanet{Results: []client.Results{{Name: "Tatooine", Films: []string{"film 1"}}}}
+
+	var emptyResponse *repository.Planet
+
+	mongoMock.On("FindById", id).Return(&storedPlanet, nil)
+	swapiMock.On("GetPlanetByName", "Tatooine").Return(&swapiResponse, nil)
+	swapiMock.On("GetFilms", mock2.Anything).Return([]client.SwapiFilm{}, nil)
+	mongoMock.On("Update", mock2.Anything).Return(emptyResponse, &repository.DuplicateError{Id: existingId})
+
+	r, _ := http.NewRequest("PATCH", "/v1/planets/5ea7208049e00ddb76994ede", bytes.NewBufferString(`{"name":"Tatooine"}`))
+
+	r.Header.Set("Content-Type", "application/merge-patch+json")
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.PatchPlanet(w, r)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "/v1/planets/5ea7208049e00ddb76994edf", w.Header().Get("Location"))
+}
+
+func TestShouldSetRequestIdWhenMissing(t *testing.T) {
+	var received string
+
+	h := handler.RequestId(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("X-Request-Id")
+	}))
+
+	r, _ := http.NewRequest("GET", "/v1/planets", nil)
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	assert.NotEmpty(t, received)
+	assert.Equal(t, received, w.Header().Get("X-Request-Id"))
+
+	r, _ = http.NewRequest("GET", "/v1/planets", nil)
+	r.Header.Set("X-Request-Id", "request-1")
+	w = httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, "request-1", received)
+	assert.Equal(t, "request-1", w.Header().Get("X-Request-Id"))
+}
+
+// blockingSwapiClient never answers, returning only when the context ends.
+type blockingSwapiClient struct{}
+
+func (b blockingSwapiClient) GetPlanetByName(ctx context.Context, name string) (*client.SwapiPlanet, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (b blockingSwapiClient) ListPlanets(ctx context.Context, search string) *client.PlanetIterator {
+	return client.NewPlanetIterator(nil)
+}
+
+func (b blockingSwapiClient) GetFilm(ctx context.Context, url string) (*client.SwapiFilm, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (b blockingSwapiClient) GetFilms(ctx context.Context, urls []string) ([]client.SwapiFilm, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (b blockingSwapiClient) GetPerson(ctx context.Context, url string) (*client.SwapiPerson, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (b blockingSwapiClient) GetPeople(ctx context.Context, urls []string) ([]client.SwapiPerson, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestShouldReturnGatewayTimeoutWhenSwapiLookupExceedsDeadline(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	timeouts := config.NewDefaultTimeoutConfig()
+	timeouts.Swapi = 50 * time.Millisecond
+
+	h := handler.NewPlanetHandlerWithTimeouts(mongoMock, blockingSwapiClient{}, mockLogger, timeouts)
+
+	r, _ := http.NewRequest("POST", "/v1/planets", bytes.NewBufferString(`{"name":"Tatooine"}`))
+
+	w := httptest.NewRecorder()
+
+	h.SavePlanet(w, r)
+
+	mongoMock.AssertNumberOfCalls(t, "Save", 0)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+}
+
+func TestShouldPropagateRequestCancellationToRepository(t *testing.T) {
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(repository.NewMemory(), swapiMock, mockLogger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r, _ := http.NewRequestWithContext(ctx, "GET", "/v1/planets", nil)
+
+	w := httptest.NewRecorder()
+
+	h.GetPlanets(w, r)
+
+	assert.Equal(t, 499, w.Code)
+}
+
+func TestShouldReturnNotFoundWithCandidatesWhenSwapiHasNoExactMatch(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	swapiResponse := client.SwapiPlanet{Results: []client.Results{{Name: "Hoth Prime", Films: []string{"film 1"}}}}
+
+	swapiMock.On("GetPlanetByName", "Hoth").Return(&swapiResponse, nil)
+	swapiMock.On("GetFilms", mock2.Anything).Return([]client.SwapiFilm{}, nil)
+
+	r, _ := http.NewRequest("POST", "/v1/planets", bytes.NewBufferString(`{"name":"Hoth"}`))
+
+	w := httptest.NewRecorder()
+
+	h.SavePlanet(w, r)
+
+	mongoMock.AssertNumberOfCalls(t, "Save", 0)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "{\"type\":\"/problems/swapi-planet-not-found\",\"title\":\"Planet not found in SWAPI\",\"status\":404,\"detail\":\"no SWAPI planet has this name, register it with source custom to add an original planet\",\"candidates\":[\"Hoth Prime\"]}", w.Body.String())
+}
+
+func TestShouldReturnConflictWithCandidatesWhenSwapiMatchIsAmbiguous(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	swapiResponse := client.SwapiPlanet{Results: []client.Results{{Name: "Hoth"}, {Name: "hoth"}}}
+
+	swapiMock.On("GetPlanetByName", "Hoth").Return(&swapiResponse, nil)
+	swapiMock.On("GetFilms", mock2.Anything).Return([]client.SwapiFilm{}, nil)
+
+	r, _ := http.NewRequest("POST", "/v1/planets", bytes.NewBufferString(`{"name":"Hoth"}`))
+
+	w := httptest.NewRecorder()
+
+	h.SavePlanet(w, r)
+
+	mongoMock.AssertNumberOfCalls(t, "Save", 0)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "{\"type\":\"/problems/ambiguous-swapi-planet\",\"title\":\"Several planets match in SWAPI\",\"status\":409,\"detail\":\"more than one SWAPI planet has this name, pick one of the candidates\",\"candidates\":[\"Hoth\",\"hoth\"]}", w.Body.String())
+}
+
+func TestShouldStoreFilmsWhenCreatingPlanet(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	filmUrls := []string{"https://swapi.dev/api/films/2/"}
+	swapiResponse := client.SwapiPlanet{Results: []client.Results{{Name: "Hoth", Films: filmUrls}}}
+	swapiFilms := []client.SwapiFilm{{Title: "The Empire Strikes Back", EpisodeId: 5, ReleaseDate: "1980-05-17", Url: filmUrls[0]}}
+
+	swapiMock.On("GetPlanetByName", "Hoth").Return(&swapiResponse, nil)
+	swapiMock.On("GetFilms", filmUrls).Return(swapiFilms, nil)
+	mongoMock.On("Save", mock2.MatchedBy(func(planet *repository.Planet) bool {
+		return assert.ObjectsAreEqual([]repository.Film{{Title: "The Empire Strikes Back", EpisodeId: 5, ReleaseDate: "1980-05-17",
+			Url: filmUrls[0]}}, planet.Films)
+	})).Return(&repository.Planet{}, nil)
+
+	r, _ := http.NewRequest("POST", "/v1/planets", bytes.NewBufferString(`{"name":"Hoth"}`))
+
+	w := httptest.NewRecorder()
+
+	h.SavePlanet(w, r)
+
+	mongoMock.AssertExpectations(t)
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestShouldGetPlanetFilms(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	storedPlanet := repository.Planet{Id: id, Name: "Hoth",
+		Films: []repository.Film{{Title: "The Empire Strikes Back", EpisodeId: 5, ReleaseDate: "1980-05-17", Url: "https://swapi.dev/api/films/2/"}}}
+
+	mongoMock.On("FindById", id).Return(&storedPlanet, nil)
+
+	r, _ := http.NewRequest("GET", "/v1/planets/5ea7208049e00ddb76994ede/films", nil)
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.GetPlanetFilms(w, r)
+
+	swapiMock.AssertNumberOfCalls(t, "GetFilms", 0)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assertGolden(t, "planet-films", w.Body.Bytes())
+}
+
+func TestShouldResolveFilmsOfPlanetStoredWithoutThem(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	filmUrls := []string{"https://swapi.dev/api/films/2/"}
+	storedPlanet := repository.Planet{Id: id, Name: "Hoth", Swapi: &repository.SwapiData{Films: filmUrls}}
+
+	mongoMock.On("FindById", id).Return(&storedPlanet, nil)
+	swapiMock.On("GetFilms", filmUrls).Return([]client.SwapiFilm{{Title: "The Empire Strikes Back", EpisodeId: 5}}, nil)
+
+	r, _ := http.NewRequest("GET", "/v1/planets/5ea7208049e00ddb76994ede/films", nil)
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.GetPlanetFilms(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assertGolden(t, "planet-films-resolved", w.Body.Bytes())
+}
+
+func TestShouldReturnNotFoundWhenGettingFilmsOfUnknownPlanet(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	var noPlanet *repository.Planet
+	mongoMock.On("FindById", id).Return(noPlanet, repository.ErrNotFound)
+
+	r, _ := http.NewRequest("GET", "/v1/planets/5ea7208049e00ddb76994ede/films", nil)
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.GetPlanetFilms(w, r)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestShouldGetPlanetResidents(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	residentUrls := []string{"https://swapi.dev/api/people/1/", "https://swapi.dev/api/people/2/"}
+	storedPlanet := repository.Planet{Id: id, Name: "Tatooine", Swapi: &repository.SwapiData{Residents: residentUrls}}
+
+	mongoMock.On("FindById", id).Return(&storedPlanet, nil)
+	swapiMock.On("GetPeople", residentUrls).Return([]client.SwapiPerson{
+		{Name: "Luke Skywalker", BirthYear: "19BBY", Homeworld: "https://swapi.dev/api/planets/1/", Url: residentUrls[0]},
+		{Name: "C-3PO", BirthYear: "112BBY", Homeworld: "https://swapi.dev/api/planets/1/",
+			Species: []string{"https://swapi.dev/api/species/2/"}, Url: residentUrls[1]},
+	}, nil)
+
+	r, _ := http.NewRequest("GET", "/v1/planets/5ea7208049e00ddb76994ede/residents", nil)
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.GetPlanetResidents(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assertGolden(t, "planet-residents", w.Body.Bytes())
+}
+
+func TestShouldReturnNoResidentsForPlanetUnknownInSwapi(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	mongoMock.On("FindById", id).Return(&repository.Planet{Id: id, Name: "Custom"}, nil)
+
+	r, _ := http.NewRequest("GET", "/v1/planets/5ea7208049e00ddb76994ede/residents", nil)
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.GetPlanetResidents(w, r)
+
+	swapiMock.AssertNumberOfCalls(t, "GetPeople", 0)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `[]`, w.Body.String())
+}
+
+func TestShouldReturnInternalErrorWhenResidentsCannotBeResolved(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	residentUrls := []string{"https://swapi.dev/api/people/1/"}
+	mongoMock.On("FindById", id).Return(&repository.Planet{Id: id, Swapi: &repository.SwapiData{Residents: residentUrls}}, nil)
+	var noPeople []client.SwapiPerson
+	swapiMock.On("GetPeople", residentUrls).Return(noPeople, errors.New("swapi is down"))
+
+	r, _ := http.NewRequest("GET", "/v1/planets/5ea7208049e00ddb76994ede/residents", nil)
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.GetPlanetResidents(w, r)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestShouldCreateCustomPlanetWithoutAskingSwapi(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	mongoMock.On("Save", mock2.MatchedBy(func(planet *repository.Planet) bool {
+		return planet.Source == repository.SourceCustom && planet.AppearanceQuantity == 0 && planet.Swapi == nil &&
+			planet.Name == "Zeltros" && planet.Weather == "temperate" && planet.Land == "plains"
+	})).Return(&repository.Planet{}, nil)
+
+	r, _ := http.NewRequest("POST", "/v1/planets",
+		bytes.NewBufferString(`{"name":"Zeltros","weather":"temperate","land":"plains","source":"custom"}`))
+
+	w := httptest.NewRecorder()
+
+	h.SavePlanet(w, r)
+
+	mongoMock.AssertExpectations(t)
+	swapiMock.AssertNumberOfCalls(t, "GetPlanetByName", 0)
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestShouldNotChangeSourceOfPlanet(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	mongoMock.On("FindById", id).Return(&repository.Planet{Id: id, Name: "Tatooine"}, nil)
+
+	r, _ := http.NewRequest("PATCH", "/v1/planets/5ea7208049e00ddb76994ede",
+		bytes.NewBufferString(`{"source":"custom","weather":"arid","land":"desert"}`))
+
+	r.Header.Set("Content-Type", "application/merge-patch+json")
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.PatchPlanet(w, r)
+
+	mongoMock.AssertNumberOfCalls(t, "Update", 0)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `{"field":"source","message":"cannot be changed"}`)
+}
+
+func TestShouldRenameCustomPlanetWithoutAskingSwapi(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	swapiMock := new(mock.SwapiClientMock)
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(mongoMock, swapiMock, mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	storedPlanet := repository.Planet{Id: id, Name: "Zeltros", Weather: "temperate", Land: "plains", Source: repository.SourceCustom}
+	renamedPlanet := storedPlanet
+	renamedPlanet.Name = "Zeltros Prime"
+
+	mongoMock.On("FindById", id).Return(&storedPlanet, nil)
+	mongoMock.On("Update", &renamedPlanet).Return(&renamedPlanet, nil)
+
+	r, _ := http.NewRequest("PUT", "/v1/planets/5ea7208049e00ddb76994ede",
+		bytes.NewBufferString(`{"name":"Zeltros Prime","weather":"temperate","land":"plains"}`))
+
+	r = mux.SetURLVars(r, map[string]string{"planetId": "5ea7208049e00ddb76994ede"})
+
+	w := httptest.NewRecorder()
+
+	h.UpdatePlanet(w, r)
+
+	swapiMock.AssertNumberOfCalls(t, "GetPlanetByName", 0)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func postPlanet(h *handler.PlanetHandler, key string, body string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("POST", "/v1/planets", bytes.NewBufferString(body))
+	r.Header.Set("Idempotency-Key", key)
+
+	w := httptest.NewRecorder()
+
+	h.SavePlanet(w, r)
+
+	return w
+}
+
+func TestShouldReplayCreatedPlanetWhenIdempotencyKeyIsReused(t *testing.T) {
+	repo := repository.NewMemory()
+	mockLogger := new(mock.LoggerMock)
+
+	h := handler.NewPlanetHandler(repo, new(mock.SwapiClientMock), mockLogger)
+
+	body := `{"name":"Zeltros","weather":"temperate","land":"plains","source":"custom"}`
+
+	first := postPlanet(h, "create-zeltros", body)
+	retried := postPlanet(h, "create-zeltros", body)
+
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, http.StatusCreated, retried.Code)
+	assert.Equal(t, first.Body.String(), retried.Body.String())
+	assert.Equal(t, first.Header().Get("Location"), retried.Header().Get("Location"))
+	assert.Equal(t, first.Header().Get("Content-Type"), retried.Header().Get("Content-Type"))
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, "true", retried.Header().Get("Idempotent-Replayed"))
+
+	count, _ := repo.Count(context.Background(), repository.Filter{})
+	assert.Equal(t, int64(1), count)
+}
+
+func TestShouldReturnUnprocessableEntityWhenIdempotencyKeyIsReusedWithAnotherBody(t *testing.T) {
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(repository.NewMemory(), new(mock.SwapiClientMock), mockLogger)
+
+	first := postPlanet(h, "create-zeltros", `{"name":"Zeltros","weather":"temperate","land":"plains","source":"custom"}`)
+	reused := postPlanet(h, "create-zeltros", `{"name":"Zeltros","weather":"arid","land":"plains","source":"custom"}`)
+
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	assert.Equal(t, "{\"type\":\"/problems/idempotency-key-reused\",\"title\":\"Idempotency key reused\",\"status\":422,\"detail\":\"this Idempotency-Key was already used with a different request\"}", reused.Body.String())
+}
+
+func TestShouldLimitPlanetBodyWhenIdempotencyKeyIsSet(t *testing.T) {
+	repo := repository.NewMemory()
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(repo, new(mock.SwapiClientMock), mockLogger)
+
+	body := &countingReader{reader: strings.NewReader(`{"name":"Zeltros","weather":"temperate","land":"plains",` +
+		`"source":"custom"}` + strings.Repeat(" ", 1<<19))}
+
+	r, _ := http.NewRequest("POST", "/v1/planets", body)
+	r.Header.Set("Idempotency-Key", "create-zeltros")
+
+	w := httptest.NewRecorder()
+
+	h.SavePlanet(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.True(t, body.read <= 1<<15, body.read)
+
+	_, err := repo.FindIdempotencyRecord(context.Background(), "create-zeltros")
+	assert.Equal(t, repository.ErrIdempotencyKeyNotFound, err)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	reader io.Reader
+	read   int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestShouldRefuseRetryWhileRequestWithSameIdempotencyKeyRuns(t *testing.T) {
+	repo := repository.NewMemory()
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(repo, new(mock.SwapiClientMock), mockLogger)
+
+	body := `{"name":"Zeltros","weather":"temperate","land":"plains","source":"custom"}`
+
+	r, _ := http.NewRequest("POST", "/v1/planets", bytes.NewBufferString(body))
+	started := make(chan struct{})
+	finish := make(chan struct{})
+
+	blockingRepo := &blockingSaveRepository{Memory: repo, started: started, finish: finish}
+	blocking := handler.NewPlanetHandler(blockingRepo, new(mock.SwapiClientMock), mockLogger)
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		r.Header.Set("Idempotency-Key", "create-zeltros")
+		blocking.SavePlanet(first, r)
+	}()
+
+	<-started
+
+	retried := postPlanet(h, "create-zeltros", body)
+
+	close(finish)
+	<-done
+
+	replayed := postPlanet(h, "create-zeltros", body)
+
+	assert.Equal(t, http.StatusConflict, retried.Code)
+	assert.Equal(t, "{\"type\":\"/problems/request-in-progress\",\"title\":\"Request in progress\",\"status\":409,\"detail\":\"a request with this Idempotency-Key is still running, retry once it finishes\"}", retried.Body.String())
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, http.StatusCreated, replayed.Code)
+	assert.Equal(t, "true", replayed.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, first.Body.String(), replayed.Body.String())
+}
+
+// blockingSaveRepository holds Save until finish is closed, telling started when it begins waiting.
+type blockingSaveRepository struct {
+	*repository.Memory
+	started chan struct{}
+	finish  chan struct{}
+}
+
+func (b *blockingSaveRepository) Save(ctx context.Context, planet *repository.Planet) (*repository.Planet, error) {
+	close(b.started)
+	<-b.finish
+	return b.Memory.Save(ctx, planet)
+}
+
+func TestShouldNotRecordFailedRequestsForIdempotencyKey(t *testing.T) {
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(repository.NewMemory(), new(mock.SwapiClientMock), mockLogger)
+
+	body := `{"name":"Zeltros","weather":"temperate","land":"plains","source":"custom"}`
+
+	failed := postPlanet(h, "create-zeltros", `{"name":"Zeltros","source":"custom"}`)
+	created := postPlanet(h, "create-zeltros", body)
+	conflicting := postPlanet(h, "create-zeltros-once-more", body)
+	retried := postPlanet(h, "create-zeltros-once-more", body)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, failed.Code)
+	assert.Equal(t, http.StatusCreated, created.Code)
+	assert.Equal(t, http.StatusConflict, conflicting.Code)
+	assert.Equal(t, http.StatusConflict, retried.Code)
+	assert.Empty(t, retried.Header().Get("Idempotent-Replayed"))
+}
+
+func newPlanetRequest(method string, id primitive.ObjectID, body string, header map[string]string) *http.Request {
+	r, _ := http.NewRequest(method, "/v1/planets/"+id.Hex(), bytes.NewBufferString(body))
+	r = mux.SetURLVars(r, map[string]string{"planetId": id.Hex()})
+
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+
+	return r
+}
+
+func TestShouldAnswerNotModifiedWhenPlanetMatchesIfNoneMatch(t *testing.T) {
+	repo := repository.NewMemory()
+	h := handler.NewPlanetHandler(repo, new(mock.SwapiClientMock), new(mock.LoggerMock))
+
+	saved, _ := repo.Save(context.Background(), &repository.Planet{Name: "Zeltros", Weather: "temperate", Land: "plains",
+		Source: repository.SourceCustom})
+
+	w := httptest.NewRecorder()
+	h.GetPlanetById(w, newPlanetRequest("GET", saved.Id, "", nil))
+
+	etag := w.Header().Get("ETag")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"`+saved.Id.Hex()+`-1"`, etag)
+
+	w = httptest.NewRecorder()
+	h.GetPlanetById(w, newPlanetRequest("GET", saved.Id, "", map[string]string{"If-None-Match": `"other", W/` + etag}))
+
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Empty(t, w.Body.String())
+}
+
+func TestShouldAnswerNotModifiedWhenPlanetPageMatchesIfNoneMatch(t *testing.T) {
+	repo := repository.NewMemory()
+	h := handler.NewPlanetHandler(repo, new(mock.SwapiClientMock), new(mock.LoggerMock))
+
+	saved, _ := repo.Save(context.Background(), &repository.Planet{Name: "Zeltros", Source: repository.SourceCustom})
+
+	r, _ := http.NewRequest("GET", "/v1/planets", nil)
+	w := httptest.NewRecorder()
+	h.GetPlanets(w, r)
+
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	r, _ = http.NewRequest("GET", "/v1/planets", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.GetPlanets(w, r)
+
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	saved.Weather = "arid"
+	_, _ = repo.Update(context.Background(), saved)
+
+	w = httptest.NewRecorder()
+	h.GetPlanets(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+func TestShouldRequireIfMatchToNameCurrentVersionWhenUpdatingPlanet(t *testing.T) {
+	repo := repository.NewMemory()
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(repo, new(mock.SwapiClientMock), mockLogger)
+
+	saved, _ := repo.Save(context.Background(), &repository.Planet{Name: "Zeltros", Weather: "temperate", Land: "plains",
+		Source: repository.SourceCustom})
+
+	current := `"` + saved.Id.Hex() + `-1"`
+	stale := `"` + saved.Id.Hex() + `-0"`
+
+	w := httptest.NewRecorder()
+	h.UpdatePlanet(w, newPlanetRequest("PUT", saved.Id, `{"name":"Zeltros","weather":"arid","land":"plains"}`,
+		map[string]string{"If-Match": stale}))
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, "{\"type\":\"/problems/precondition-failed\",\"title\":\"Precondition failed\",\"status\":412,\"detail\":\"the planet does not match If-Match, fetch it again and retry\"}", w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.PatchPlanet(w, newPlanetRequest("PATCH", saved.Id, `{"weather":"arid"}`, map[string]string{"If-Match": current,
+		"Content-Type": "application/merge-patch+json"}))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"`+saved.Id.Hex()+`-2"`, w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	h.PatchPlanet(w, newPlanetRequest("PATCH", saved.Id, `{"weather":"windy"}`, map[string]string{"If-Match": current,
+		"Content-Type": "application/merge-patch+json"}))
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	found, _ := repo.FindById(context.Background(), saved.Id)
+	assert.Equal(t, "arid", found.Weather)
+}
+
+func TestShouldRequireIfMatchToNameCurrentVersionWhenRemovingPlanet(t *testing.T) {
+	repo := repository.NewMemory()
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(repo, new(mock.SwapiClientMock), mockLogger)
+
+	saved, _ := repo.Save(context.Background(), &repository.Planet{Name: "Zeltros", Source: repository.SourceCustom})
+
+	w := httptest.NewRecorder()
+	h.RemovePlanetById(w, newPlanetRequest("DELETE", saved.Id, "", map[string]string{"If-Match": `"` + saved.Id.Hex() + `-7"`}))
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = httptest.NewRecorder()
+	h.RemovePlanetById(w, newPlanetRequest("DELETE", saved.Id, "", map[string]string{"If-Match": "*"}))
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	count, _ := repo.Count(context.Background(), repository.Filter{})
+	assert.Equal(t, int64(0), count)
+}
+
+func TestShouldReturnUnsupportedMediaTypeWhenPatchIsNotMergePatch(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, new(mock.SwapiClientMock), mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+
+	var notFound *repository.Planet
+	mongoMock.On("FindById", id).Return(notFound, repository.ErrNotFound)
+
+	for _, contentType := range []string{"", "application/json", "application/json-patch+json"} {
+		w := httptest.NewRecorder()
+		h.PatchPlanet(w, newPlanetRequest("PATCH", id, `{"weather":"arid"}`, map[string]string{"Content-Type": contentType}))
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code, contentType)
+		assert.Equal(t, "application/merge-patch+json", w.Header().Get("Accept-Patch"))
+		assert.Equal(t, "{\"type\":\"/problems/unsupported-media-type\",\"title\":\"Unsupported media type\",\"status\":415,\"detail\":\"planet patches must be sent as application/merge-patch+json\"}", w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	h.PatchPlanet(w, newPlanetRequest("PATCH", id, `{"weather":"arid"}`,
+		map[string]string{"Content-Type": "application/merge-patch+json; charset=utf-8"}))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestShouldReturnConflictWhenPlanetChangesDuringUpdate(t *testing.T) {
+	mongoMock := new(mock.MongoMock)
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	h := handler.NewPlanetHandler(mongoMock, new(mock.SwapiClientMock), mockLogger)
+
+	id, _ := primitive.ObjectIDFromHex("5ea7208049e00ddb76994ede")
+	stored := repository.Planet{Id: id, Name: "Zeltros", Weather: "temperate", Land: "plains", Source: repository.SourceCustom,
+		Version: 3}
+
+	var notUpdated *repository.Planet
+
+	mongoMock.On("FindById", id).Return(&stored, nil)
+	mongoMock.On("Update", mock2.Anything).Return(notUpdated, repository.ErrVersionConflict)
+
+	w := httptest.NewRecorder()
+	h.PatchPlanet(w, newPlanetRequest("PATCH", id, `{"weather":"arid"}`,
+		map[string]string{"Content-Type": "application/merge-patch+json"}))
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "{\"type\":\"/problems/planet-changed\",\"title\":\"Planet changed\",\"status\":409,\"detail\":\"the planet was changed by another request, fetch it again and retry\"}", w.Body.String())
 }
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/client"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/handler"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/test/unit/mock"
+	"github.com/stretchr/testify/assert"
+	mock2 "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newSyncSwapiMock() *mock.SwapiClientMock {
+	var notFound *client.SwapiPlanet
+
+	swapiMock := new(mock.SwapiClientMock)
+	swapiMock.On("GetPlanetByName", "Tatooine").Return(&client.SwapiPlanet{Results: []client.Results{{Name: "Tatooine",
+		Climate: "arid", Url: "https://swapi.dev/api/planets/1/", Films: []string{"1", "2", "3", "4", "5"}}}}, nil)
+	swapiMock.On("GetPlanetByName", "Hoth").Return(&client.SwapiPlanet{Results: []client.Results{{Name: "Hoth",
+		Climate: "frozen", Url: "https://swapi.dev/api/planets/4/"}}}, nil)
+	swapiMock.On("GetPlanetByName", "Aldebaran").Return(notFound, nil)
+	swapiMock.On("GetFilms", mock2.Anything).Return([]client.SwapiFilm{}, nil)
+
+	return swapiMock
+}
+
+func TestShouldSyncStoredPlanetsInBatches(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemory()
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	tatooine := repository.Planet{Name: "Tatooine", AppearanceQuantity: 2}
+	hoth := repository.Planet{Name: "Hoth", Swapi: &repository.SwapiData{Url: "https://swapi.dev/api/planets/4/", Climate: []string{"frozen"}}}
+	aldebaran := repository.Planet{Name: "Aldebaran", AppearanceQuantity: 1}
+	zeltros := repository.Planet{Name: "Zeltros", Source: repository.SourceCustom}
+
+	for _, planet := range []*repository.Planet{&tatooine, &zeltros, &hoth, &aldebaran} {
+		_, err := repo.Save(ctx, planet)
+		require.NoError(t, err)
+	}
+
+	syncer := handler.NewSyncer(repo, newSyncSwapiMock(), mockLogger, config.NewDefaultTimeoutConfig(),
+		config.SyncConfig{BatchSize: 2})
+
+	syncer.Sync(ctx)
+
+	status := syncer.Status()
+	assert.False(t, status.Running)
+	assert.NotNil(t, status.FinishedAt)
+	assert.Equal(t, 3, status.Checked)
+	assert.Equal(t, 1, status.Updated)
+	assert.Equal(t, 1, status.Failed)
+	assert.Empty(t, status.Error)
+
+	synced, _ := repo.FindById(ctx, tatooine.Id)
+	assert.Equal(t, 5, synced.AppearanceQuantity)
+	assert.Equal(t, []string{"arid"}, synced.Swapi.Climate)
+	assert.NotNil(t, synced.SyncedAt)
+	assert.Equal(t, tatooine.Version+1, synced.Version)
+
+	synced, _ = repo.FindById(ctx, hoth.Id)
+	assert.NotNil(t, synced.SyncedAt)
+	assert.Equal(t, hoth.Version, synced.Version)
+	assert.Equal(t, hoth.UpdatedAt, synced.UpdatedAt)
+
+	notSynced, _ := repo.FindById(ctx, aldebaran.Id)
+	assert.Equal(t, aldebaran, *notSynced)
+
+	notSynced, _ = repo.FindById(ctx, zeltros.Id)
+	assert.Equal(t, zeltros, *notSynced)
+}
+
+func TestShouldSyncWhenTriggered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := repository.NewMemory()
+	mockLogger := new(mock.LoggerMock)
+	mockLogger.On("LogWithFields", mock2.Anything, mock2.Anything, mock2.Anything, mock2.Anything).Return(nil)
+
+	_, err := repo.Save(ctx, &repository.Planet{Name: "Tatooine"})
+	require.NoError(t, err)
+
+	syncer := handler.NewSyncer(repo, newSyncSwapiMock(), mockLogger, config.NewDefaultTimeoutConfig(),
+		config.SyncConfig{BatchSize: 10})
+
+	go syncer.Run(ctx)
+
+	w := httptest.NewRecorder()
+	syncer.TriggerSync(w, httptest.NewRequest("POST", "/v1/admin/sync", nil))
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	assert.Eventually(t, func() bool {
+		status := syncer.Status()
+		return status.FinishedAt != nil && status.Checked == 1
+	}, time.Second, 10*time.Millisecond)
+
+	w = httptest.NewRecorder()
+	syncer.GetSyncStatus(w, httptest.NewRequest("GET", "/v1/admin/sync", nil))
+
+	var status handler.SyncStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, status.Updated)
+	assert.False(t, status.Running)
+}
+
+func TestShouldReportIdleSyncStatus(t *testing.T) {
+	syncer := handler.NewSyncer(repository.NewMemory(), new(mock.SwapiClientMock), new(mock.LoggerMock),
+		config.NewDefaultTimeoutConfig(), config.NewDefaultSyncConfig())
+
+	w := httptest.NewRecorder()
+	syncer.GetSyncStatus(w, httptest.NewRequest("GET", "/v1/admin/sync", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assertGolden(t, "sync-status-idle", w.Body.Bytes())
+}
@@ -1,31 +1,83 @@
 package mock
 
 import (
+	"context"
 	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
 	"github.com/stretchr/testify/mock"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
 )
 
 type MongoMock struct {
 	mock.Mock
 }
 
-func (m *MongoMock) FindById(id primitive.ObjectID) (*repository.Planet, error) {
+func (m *MongoMock) FindById(ctx context.Context, id primitive.ObjectID) (*repository.Planet, error) {
 	args := m.Called(id)
 	return args.Get(0).(*repository.Planet), args.Error(1)
 }
 
-func (m *MongoMock) FindAll(filter repository.Filter) (*[]repository.Planet, error) {
+func (m *MongoMock) FindAll(ctx context.Context, filter repository.Filter) (*[]repository.Planet, error) {
 	args := m.Called(filter)
 	return args.Get(0).(*[]repository.Planet), args.Error(1)
 }
 
-func (m *MongoMock) Save(planet *repository.Planet) (*repository.Planet, error) {
+func (m *MongoMock) Save(ctx context.Context, planet *repository.Planet) (*repository.Planet, error) {
 	args := m.Called(planet)
 	return args.Get(0).(*repository.Planet), args.Error(1)
 }
 
-func (m *MongoMock) Delete(id primitive.ObjectID) error {
+func (m *MongoMock) Delete(ctx context.Context, id primitive.ObjectID) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
+
+func (m *MongoMock) Update(ctx context.Context, planet *repository.Planet) (*repository.Planet, error) {
+	args := m.Called(planet)
+	return args.Get(0).(*repository.Planet), args.Error(1)
+}
+
+func (m *MongoMock) Count(ctx context.Context, filter repository.Filter) (int64, error) {
+	args := m.Called(filter)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MongoMock) FindIdempotencyRecord(ctx context.Context, key string) (*repository.IdempotencyRecord, error) {
+	args := m.Called(key)
+	return args.Get(0).(*repository.IdempotencyRecord), args.Error(1)
+}
+
+func (m *MongoMock) SaveIdempotencyRecord(ctx context.Context, record *repository.IdempotencyRecord) error {
+	args := m.Called(record)
+	return args.Error(0)
+}
+
+func (m *MongoMock) DeleteVersion(ctx context.Context, id primitive.ObjectID, version int64) error {
+	args := m.Called(id, version)
+	return args.Error(0)
+}
+
+func (m *MongoMock) MarkSynced(ctx context.Context, id primitive.ObjectID, syncedAt time.Time) error {
+	args := m.Called(id, syncedAt)
+	return args.Error(0)
+}
+
+func (m *MongoMock) InsertMany(ctx context.Context, planets []*repository.Planet) []error {
+	args := m.Called(planets)
+	return args.Get(0).([]error)
+}
+
+func (m *MongoMock) DeleteMany(ctx context.Context, filter repository.Filter) (int64, error) {
+	args := m.Called(filter)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MongoMock) ReplaceIdempotencyRecord(ctx context.Context, record *repository.IdempotencyRecord) error {
+	args := m.Called(record)
+	return args.Error(0)
+}
+
+func (m *MongoMock) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
@@ -1,6 +1,7 @@
 package mock
 
 import (
+	"context"
 	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/client"
 	"github.com/stretchr/testify/mock"
 )
@@ -9,7 +10,32 @@ type SwapiClientMock struct {
 	mock.Mock
 }
 
-func (m *SwapiClientMock) GetPlanetByName(name string) (*client.SwapiPlanet, error)  {
+func (m *SwapiClientMock) GetPlanetByName(ctx context.Context, name string) (*client.SwapiPlanet, error) {
 	args := m.Called(name)
 	return args.Get(0).(*client.SwapiPlanet), args.Error(1)
-}
\ No newline at end of file
+}
+
+func (m *SwapiClientMock) ListPlanets(ctx context.Context, search string) *client.PlanetIterator {
+	args := m.Called(search)
+	return args.Get(0).(*client.PlanetIterator)
+}
+
+func (m *SwapiClientMock) GetFilm(ctx context.Context, url string) (*client.SwapiFilm, error) {
+	args := m.Called(url)
+	return args.Get(0).(*client.SwapiFilm), args.Error(1)
+}
+
+func (m *SwapiClientMock) GetFilms(ctx context.Context, urls []string) ([]client.SwapiFilm, error) {
+	args := m.Called(urls)
+	return args.Get(0).([]client.SwapiFilm), args.Error(1)
+}
+
+func (m *SwapiClientMock) GetPerson(ctx context.Context, url string) (*client.SwapiPerson, error) {
+	args := m.Called(url)
+	return args.Get(0).(*client.SwapiPerson), args.Error(1)
+}
+
+func (m *SwapiClientMock) GetPeople(ctx context.Context, urls []string) ([]client.SwapiPerson, error) {
+	args := m.Called(urls)
+	return args.Get(0).([]client.SwapiPerson), args.Error(1)
+}
@@ -0,0 +1,480 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+// runConformance checks that an implementation of PlanetRepositoryInterface behaves like every other one.
+// newRepository must return an empty repository.
+func runConformance(t *testing.T, newRepository func(t *testing.T) repository.PlanetRepositoryInterface) {
+	ctx := context.Background()
+
+	t.Run("SaveGeneratesIdAndFindById", func(t *testing.T) {
+		repo := newRepository(t)
+
+		saved, err := repo.Save(ctx, &repository.Planet{Name: "Tatooine", Weather: "arid", Land: "desert", AppearanceQuantity: 5})
+
+		require.NoError(t, err)
+		assert.False(t, saved.Id.IsZero())
+		require.NotNil(t, saved.CreatedAt)
+		assert.Equal(t, saved.CreatedAt, saved.UpdatedAt)
+
+		found, err := repo.FindById(ctx, saved.Id)
+
+		require.NoError(t, err)
+		assert.Equal(t, saved, found)
+	})
+
+	t.Run("FindByIdUnknown", func(t *testing.T) {
+		repo := newRepository(t)
+
+		found, err := repo.FindById(ctx, primitive.NewObjectID())
+
+		assert.Equal(t, repository.ErrNotFound, err)
+		assert.Nil(t, found)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo := newRepository(t)
+
+		saved, _ := repo.Save(ctx, &repository.Planet{Name: "Hoth", Weather: "frozen", Land: "tundra", AppearanceQuantity: 1})
+
+		changed := *saved
+		changed.Weather = "cold"
+
+		updated, err := repo.Update(ctx, &changed)
+
+		require.NoError(t, err)
+		assert.Equal(t, "cold", updated.Weather)
+
+		found, _ := repo.FindById(ctx, saved.Id)
+
+		assert.Equal(t, "cold", found.Weather)
+		assert.Equal(t, saved.CreatedAt, found.CreatedAt)
+		assert.False(t, found.UpdatedAt.Before(*saved.UpdatedAt))
+	})
+
+	t.Run("UpdateUnknown", func(t *testing.T) {
+		repo := newRepository(t)
+
+		_, err := repo.Update(ctx, &repository.Planet{Id: primitive.NewObjectID(), Name: "Hoth"})
+
+		assert.Equal(t, repository.ErrNotFound, err)
+	})
+
+	t.Run("SaveDuplicateNameIgnoringCase", func(t *testing.T) {
+		repo := newRepository(t)
+
+		saved, _ := repo.Save(ctx, &repository.Planet{Name: "Tatooine"})
+
+		_, err := repo.Save(ctx, &repository.Planet{Name: "tatooine"})
+
+		var duplicate *repository.DuplicateError
+		require.True(t, errors.As(err, &duplicate))
+		assert.True(t, errors.Is(err, repository.ErrDuplicate))
+		assert.Equal(t, saved.Id, duplicate.Id)
+
+		count, _ := repo.Count(ctx, repository.Filter{})
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("UpdateToDuplicateName", func(t *testing.T) {
+		repo := newRepository(t)
+
+		tatooine, _ := repo.Save(ctx, &repository.Planet{Name: "Tatooine"})
+		hoth, _ := repo.Save(ctx, &repository.Planet{Name: "Hoth"})
+
+		_, err := repo.Update(ctx, &repository.Planet{Id: hoth.Id, Name: "TATOOINE", Version: hoth.Version})
+
+		var duplicate *repository.DuplicateError
+		require.True(t, errors.As(err, &duplicate))
+		assert.Equal(t, tatooine.Id, duplicate.Id)
+
+		_, err = repo.Update(ctx, &repository.Planet{Id: hoth.Id, Name: "hoth", Weather: "frozen", Version: hoth.Version})
+		assert.NoError(t, err)
+	})
+
+	t.Run("UpdateChecksVersion", func(t *testing.T) {
+		repo := newRepository(t)
+
+		saved, _ := repo.Save(ctx, &repository.Planet{Name: "Hoth", Weather: "frozen"})
+		assert.Equal(t, int64(1), saved.Version)
+
+		first := *saved
+		first.Weather = "cold"
+
+		updated, err := repo.Update(ctx, &first)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), updated.Version)
+
+		stale := *saved
+		stale.Version = 1
+		stale.Weather = "icy"
+
+		_, err = repo.Update(ctx, &stale)
+		assert.Equal(t, repository.ErrVersionConflict, err)
+
+		found, _ := repo.FindById(ctx, saved.Id)
+		assert.Equal(t, "cold", found.Weather)
+		assert.Equal(t, int64(2), found.Version)
+	})
+
+	t.Run("InsertMany", func(t *testing.T) {
+		repo := newRepository(t)
+
+		tatooine, _ := repo.Save(ctx, &repository.Planet{Name: "Tatooine"})
+
+		planets := []*repository.Planet{{Name: "Hoth"}, {Name: "TATOOINE"}, {Name: "Dagobah"}, {Name: "hoth"}}
+
+		errs := repo.InsertMany(ctx, planets)
+
+		require.Len(t, errs, 4)
+		assert.NoError(t, errs[0])
+		assert.NoError(t, errs[2])
+
+		var duplicate *repository.DuplicateError
+		require.True(t, errors.As(errs[1], &duplicate))
+		assert.Equal(t, tatooine.Id, duplicate.Id)
+		require.True(t, errors.As(errs[3], &duplicate))
+		assert.Equal(t, planets[0].Id, duplicate.Id)
+
+		found, err := repo.FindById(ctx, planets[2].Id)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), found.Version)
+		assert.NotNil(t, found.CreatedAt)
+
+		count, _ := repo.Count(ctx, repository.Filter{})
+		assert.Equal(t, int64(3), count)
+	})
+
+	t.Run("DeleteMany", func(t *testing.T) {
+		repo := newRepository(t)
+		seed(t, repo)
+
+		deleted, err := repo.DeleteMany(ctx, repository.Filter{Weather: []string{"temperate"}, Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), deleted)
+
+		planets, _ := repo.FindAll(ctx, repository.Filter{})
+		assert.Equal(t, []string{"Hoth", "Tatooine", "Dagobah"}, names(*planets))
+	})
+
+	t.Run("DeleteVersion", func(t *testing.T) {
+		repo := newRepository(t)
+
+		saved, _ := repo.Save(ctx, &repository.Planet{Name: "Alderaan"})
+
+		assert.Equal(t, repository.ErrVersionConflict, repo.DeleteVersion(ctx, saved.Id, saved.Version+1))
+		require.NoError(t, repo.DeleteVersion(ctx, saved.Id, saved.Version))
+		assert.Equal(t, repository.ErrNotFound, repo.DeleteVersion(ctx, saved.Id, saved.Version))
+	})
+
+	t.Run("MarkSynced", func(t *testing.T) {
+		repo := newRepository(t)
+
+		saved, _ := repo.Save(ctx, &repository.Planet{Name: "Alderaan"})
+		syncedAt := time.Now().UTC().Truncate(time.Millisecond)
+
+		require.NoError(t, repo.MarkSynced(ctx, saved.Id, syncedAt))
+
+		found, err := repo.FindById(ctx, saved.Id)
+		require.NoError(t, err)
+		require.NotNil(t, found.SyncedAt)
+		assert.True(t, syncedAt.Equal(*found.SyncedAt))
+		assert.Equal(t, saved.Version, found.Version)
+		assert.True(t, saved.UpdatedAt.Equal(*found.UpdatedAt))
+
+		assert.Equal(t, repository.ErrNotFound, repo.MarkSynced(ctx, primitive.NewObjectID(), syncedAt))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo := newRepository(t)
+
+		saved, _ := repo.Save(ctx, &repository.Planet{Name: "Alderaan"})
+
+		require.NoError(t, repo.Delete(ctx, saved.Id))
+
+		found, err := repo.FindById(ctx, saved.Id)
+
+		assert.Equal(t, repository.ErrNotFound, err)
+		assert.Nil(t, found)
+	})
+
+	t.Run("DeleteUnknown", func(t *testing.T) {
+		repo := newRepository(t)
+
+		assert.Equal(t, repository.ErrNotFound, repo.Delete(ctx, primitive.NewObjectID()))
+	})
+
+	t.Run("CanceledContext", func(t *testing.T) {
+		repo := newRepository(t)
+
+		saved, _ := repo.Save(ctx, &repository.Planet{Name: "Tatooine"})
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := repo.FindById(canceled, saved.Id)
+		assert.Error(t, err)
+
+		_, err = repo.FindAll(canceled, repository.Filter{})
+		assert.Error(t, err)
+
+		_, err = repo.Save(canceled, &repository.Planet{Name: "Hoth"})
+		assert.Error(t, err)
+
+		assert.Error(t, repo.Delete(canceled, saved.Id))
+
+		count, _ := repo.Count(ctx, repository.Filter{})
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("FindAllAndCountWithFilter", func(t *testing.T) {
+		repo := newRepository(t)
+		seed(t, repo)
+
+		two, four := 2, 4
+
+		cases := []struct {
+			filter   repository.Filter
+			expected []string
+		}{
+			{repository.Filter{}, []string{"Alderaan", "Hoth", "Tatooine", "Yavin IV", "Dagobah"}},
+			{repository.Filter{Name: "Hoth"}, []string{"Hoth"}},
+			{repository.Filter{Name: "hoth"}, []string{}},
+			{repository.Filter{NamePrefix: "ta"}, []string{"Tatooine"}},
+			{repository.Filter{NameContains: "AN"}, []string{"Alderaan"}},
+			{repository.Filter{NameContains: "."}, []string{}},
+			{repository.Filter{Weather: []string{"ARID", "murky"}}, []string{"Tatooine", "Dagobah"}},
+			{repository.Filter{Land: []string{"jungle"}}, []string{"Yavin IV"}},
+			{repository.Filter{AppearanceQuantityGte: &two, AppearanceQuantityLt: &four}, []string{"Alderaan", "Hoth", "Dagobah"}},
+			{repository.Filter{AppearanceQuantityGt: &two, AppearanceQuantityLte: &four}, []string{"Hoth"}},
+		}
+
+		for _, c := range cases {
+			planets, err := repo.FindAll(ctx, c.filter)
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, names(*planets), "%+v", c.filter)
+
+			count, err := repo.Count(ctx, c.filter)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(c.expected)), count, "%+v", c.filter)
+		}
+	})
+
+	t.Run("SwapiDataAndFilmsRoundTripAndFilter", func(t *testing.T) {
+		repo := newRepository(t)
+
+		number := func(value int64) *int64 { return &value }
+		count := func(value int) *int { return &value }
+		gravity := 1.0
+		syncedAt := time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC)
+
+		planets := []repository.Planet{
+			{Name: "Tatooine", Swapi: &repository.SwapiData{Url: "https://swapi.dev/api/planets/1/", Diameter: number(10465),
+				Gravity: &gravity, Population: number(200000), Climate: []string{"arid"}, Terrain: []string{"desert"},
+				Residents: []string{"https://swapi.dev/api/people/1/", "https://swapi.dev/api/people/2/"},
+				Films:     []string{"https://swapi.dev/api/films/1/"}},
+				Films:    []repository.Film{{Title: "A New Hope", EpisodeId: 4, ReleaseDate: "1977-05-25", Url: "https://swapi.dev/api/films/1/"}},
+				SyncedAt: &syncedAt},
+			{Name: "Yavin IV", Swapi: &repository.SwapiData{Diameter: number(10200), Population: number(1000),
+				Climate: []string{"temperate", "tropical"}, Terrain: []string{"jungle", "rainforests"}}},
+			{Name: "Hoth", Swapi: &repository.SwapiData{Diameter: number(7200), Climate: []string{"frozen"},
+				Residents: []string{"https://swapi.dev/api/people/10/"}},
+				Films: []repository.Film{{Title: "The Empire Strikes Back", EpisodeId: 5}}},
+			{Name: "Custom"},
+		}
+
+		for i := range planets {
+			_, err := repo.Save(ctx, &planets[i])
+			require.NoError(t, err)
+		}
+
+		found, err := repo.FindById(ctx, planets[0].Id)
+		require.NoError(t, err)
+		assert.Equal(t, planets[0], *found)
+
+		for _, c := range []struct {
+			filter   repository.Filter
+			expected []string
+		}{
+			{repository.Filter{Climate: []string{"Tropical", "arid"}}, []string{"Tatooine", "Yavin IV"}},
+			{repository.Filter{Terrain: []string{"JUNGLE"}}, []string{"Yavin IV"}},
+			{repository.Filter{PopulationGte: number(1000)}, []string{"Tatooine", "Yavin IV"}},
+			{repository.Filter{PopulationLte: number(1000)}, []string{"Yavin IV"}},
+			{repository.Filter{DiameterGte: number(7200), DiameterLte: number(10200)}, []string{"Yavin IV", "Hoth"}},
+			{repository.Filter{Film: []string{"a new hope", "The Empire Strikes Back"}}, []string{"Tatooine", "Hoth"}},
+			{repository.Filter{Film: []string{"A New"}}, []string{}},
+			{repository.Filter{MinResidents: count(1)}, []string{"Tatooine", "Hoth"}},
+			{repository.Filter{MinResidents: count(2)}, []string{"Tatooine"}},
+			{repository.Filter{MinResidents: count(0)}, []string{"Tatooine", "Yavin IV", "Hoth", "Custom"}},
+		} {
+			result, err := repo.FindAll(ctx, c.filter)
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, names(*result))
+
+			count, err := repo.Count(ctx, c.filter)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(c.expected)), count)
+		}
+	})
+
+	t.Run("FindAllBySource", func(t *testing.T) {
+		repo := newRepository(t)
+
+		for _, planet := range []repository.Planet{
+			{Name: "Tatooine", Source: repository.SourceSwapi},
+			{Name: "Zeltros", Source: repository.SourceCustom},
+			{Name: "Hoth"},
+		} {
+			_, err := repo.Save(ctx, &planet)
+			require.NoError(t, err)
+		}
+
+		for source, expected := range map[string][]string{
+			"":                      {"Tatooine", "Zeltros", "Hoth"},
+			repository.SourceSwapi:  {"Tatooine", "Hoth"},
+			repository.SourceCustom: {"Zeltros"},
+		} {
+			planets, err := repo.FindAll(ctx, repository.Filter{Source: source})
+			require.NoError(t, err)
+			assert.Equal(t, expected, names(*planets), source)
+
+			count, err := repo.Count(ctx, repository.Filter{Source: source})
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(expected)), count, source)
+		}
+	})
+
+	t.Run("FindAllSortedWithOffset", func(t *testing.T) {
+		repo := newRepository(t)
+		seed(t, repo)
+
+		planets, err := repo.FindAll(ctx, repository.Filter{Sort: "name"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Alderaan", "Dagobah", "Hoth", "Tatooine", "Yavin IV"}, names(*planets))
+
+		planets, err = repo.FindAll(ctx, repository.Filter{Sort: "-appearanceQuantity", Limit: 2, Offset: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Hoth", "Dagobah"}, names(*planets))
+
+		count, err := repo.Count(ctx, repository.Filter{Sort: "-appearanceQuantity", Limit: 2, Offset: 1})
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), count)
+	})
+
+	t.Run("FindAllWithKeyset", func(t *testing.T) {
+		repo := newRepository(t)
+		saved := seed(t, repo)
+
+		planets, err := repo.FindAll(ctx, repository.Filter{Limit: 2, After: saved[1].Id.Hex()})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Tatooine", "Yavin IV"}, names(*planets))
+
+		planets, err = repo.FindAll(ctx, repository.Filter{Limit: 2, Before: saved[3].Id.Hex()})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Hoth", "Tatooine"}, names(*planets))
+	})
+
+	t.Run("IdempotencyRecords", func(t *testing.T) {
+		repo := newRepository(t)
+
+		record := repository.IdempotencyRecord{Key: "create-tatooine", RequestHash: "8f4e", Status: 201,
+			Header: map[string]string{"Location": "/v1/planets/5ea7208049e00ddb76994ede"}, Body: []byte(`{"name":"Tatooine"}`),
+			ExpiresAt: time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)}
+
+		_, err := repo.FindIdempotencyRecord(ctx, record.Key)
+		assert.Equal(t, repository.ErrIdempotencyKeyNotFound, err)
+
+		require.NoError(t, repo.SaveIdempotencyRecord(ctx, &record))
+
+		found, err := repo.FindIdempotencyRecord(ctx, record.Key)
+		require.NoError(t, err)
+		assert.Equal(t, record, *found)
+
+		assert.Equal(t, repository.ErrIdempotencyKeyExists, repo.SaveIdempotencyRecord(ctx, &record))
+	})
+
+	t.Run("PendingIdempotencyRecords", func(t *testing.T) {
+		repo := newRepository(t)
+
+		pending := repository.IdempotencyRecord{Key: "create-hoth", RequestHash: "1a2b", Header: map[string]string{},
+			Body: []byte{}, ExpiresAt: time.Now().Add(time.Minute).UTC().Truncate(time.Millisecond)}
+
+		assert.Equal(t, repository.ErrIdempotencyKeyNotFound, repo.ReplaceIdempotencyRecord(ctx, &pending))
+		require.NoError(t, repo.SaveIdempotencyRecord(ctx, &pending))
+
+		found, err := repo.FindIdempotencyRecord(ctx, pending.Key)
+		require.NoError(t, err)
+		assert.True(t, found.Pending())
+
+		completed := pending
+		completed.Status = 201
+		completed.Body = []byte(`{"name":"Hoth"}`)
+		completed.ExpiresAt = time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+
+		require.NoError(t, repo.ReplaceIdempotencyRecord(ctx, &completed))
+
+		found, err = repo.FindIdempotencyRecord(ctx, pending.Key)
+		require.NoError(t, err)
+		assert.Equal(t, completed, *found)
+
+		require.NoError(t, repo.DeleteIdempotencyRecord(ctx, pending.Key))
+
+		_, err = repo.FindIdempotencyRecord(ctx, pending.Key)
+		assert.Equal(t, repository.ErrIdempotencyKeyNotFound, err)
+		assert.NoError(t, repo.SaveIdempotencyRecord(ctx, &pending))
+	})
+
+	t.Run("ExpiredIdempotencyRecords", func(t *testing.T) {
+		repo := newRepository(t)
+
+		record := repository.IdempotencyRecord{Key: "create-hoth", RequestHash: "1a2b", Status: 201, Header: map[string]string{},
+			Body: []byte{}, ExpiresAt: time.Now().Add(-time.Minute).UTC().Truncate(time.Millisecond)}
+
+		require.NoError(t, repo.SaveIdempotencyRecord(ctx, &record))
+
+		_, err := repo.FindIdempotencyRecord(ctx, record.Key)
+		assert.Equal(t, repository.ErrIdempotencyKeyNotFound, err)
+
+		record.ExpiresAt = time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+
+		assert.NoError(t, repo.SaveIdempotencyRecord(ctx, &record))
+	})
+}
+
+// seed saves a fixed set of planets with increasing ids, in insertion order.
+func seed(t *testing.T, repo repository.PlanetRepositoryInterface) []repository.Planet {
+	ctx := context.Background()
+
+	planets := []repository.Planet{
+		{Name: "Alderaan", Weather: "temperate", Land: "grasslands", AppearanceQuantity: 2},
+		{Name: "Hoth", Weather: "frozen", Land: "tundra", AppearanceQuantity: 3},
+		{Name: "Tatooine", Weather: "arid", Land: "desert", AppearanceQuantity: 5},
+		{Name: "Yavin IV", Weather: "temperate", Land: "jungle", AppearanceQuantity: 1},
+		{Name: "Dagobah", Weather: "murky", Land: "swamp", AppearanceQuantity: 2},
+	}
+
+	for i := range planets {
+		planets[i].Id = primitive.NewObjectID()
+		_, err := repo.Save(ctx, &planets[i])
+		require.NoError(t, err)
+	}
+
+	return planets
+}
+
+func names(planets []repository.Planet) []string {
+	result := make([]string, 0, len(planets))
+	for _, planet := range planets {
+		result = append(result, planet.Name)
+	}
+	return result
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sync"
+	"testing"
+)
+
+func TestMemoryRepositoryConformance(t *testing.T) {
+	runConformance(t, func(t *testing.T) repository.PlanetRepositoryInterface {
+		return repository.NewMemory()
+	})
+}
+
+func TestMemoryRepositoryShouldSupportConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemory()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			saved, _ := repo.Save(ctx, &repository.Planet{Name: "Tatooine " + primitive.NewObjectID().Hex()})
+			_, _ = repo.FindAll(ctx, repository.Filter{NamePrefix: "Tatooine"})
+			_, _ = repo.FindById(ctx, saved.Id)
+		}()
+	}
+
+	wg.Wait()
+
+	count, err := repo.Count(ctx, repository.Filter{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(50), count)
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"os"
+	"testing"
+)
+
+// TestMongoRepositoryConformance runs against the MongoDB pointed by MONGO_URI and is skipped without it.
+func TestMongoRepositoryConformance(t *testing.T) {
+	uri := os.Getenv("MONGO_URI")
+
+	if uri == "" {
+		t.Skip("MONGO_URI is not set")
+	}
+
+	runConformance(t, func(t *testing.T) repository.PlanetRepositoryInterface {
+		mongo := repository.NewSession(config.MongoConfig{MongoURI: uri, Database: "conformance_" + primitive.NewObjectID().Hex()})
+
+		t.Cleanup(func() {
+			ctx := context.Background()
+			planets, err := mongo.FindAll(ctx, repository.Filter{})
+			require.NoError(t, err)
+			for _, planet := range *planets {
+				require.NoError(t, mongo.Delete(ctx, planet.Id))
+			}
+		})
+
+		return mongo
+	})
+}
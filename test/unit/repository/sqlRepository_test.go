@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+// newSqlRepository opens the repository described by sqlConfig, failing the test when it can not.
+func newSqlRepository(t *testing.T, sqlConfig config.SqlConfig) *repository.Sql {
+	repo, err := repository.NewSqlSession(sqlConfig)
+	require.NoError(t, err)
+	return repo
+}
+
+func TestSqlRepositoryShouldFailWhenDatabaseCanNotBeOpened(t *testing.T) {
+	repo, err := repository.NewSqlSession(config.SqlConfig{Driver: "unknown", DSN: "planets"})
+
+	assert.Error(t, err)
+	assert.Nil(t, repo)
+}
+
+// TestPostgresRepositoryConformance runs against the database pointed by POSTGRES_DSN and is skipped without it.
+func TestPostgresRepositoryConformance(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_DSN")
+
+	if dsn == "" {
+		t.Skip("POSTGRES_DSN is not set")
+	}
+
+	runConformance(t, func(t *testing.T) repository.PlanetRepositoryInterface {
+		repo := newSqlRepository(t, config.SqlConfig{Driver: "postgres", DSN: dsn})
+
+		t.Cleanup(func() {
+			ctx := context.Background()
+			planets, err := repo.FindAll(ctx, repository.Filter{})
+			require.NoError(t, err)
+			for _, planet := range *planets {
+				require.NoError(t, repo.Delete(ctx, planet.Id))
+			}
+		})
+
+		return repo
+	})
+}
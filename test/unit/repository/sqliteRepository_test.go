@@ -0,0 +1,72 @@
+//go:build cgo
+// +build cgo
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/config"
+	"github.com/bernardoms/StarWarsPlanetAPI-GO/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+// newSqliteConfig points to a new in-memory database. The sqlite3 driver needs cgo, so the tests using it only run
+// in cgo builds.
+func newSqliteConfig() config.SqlConfig {
+	return config.SqlConfig{Driver: "sqlite3", DSN: "file:" + primitive.NewObjectID().Hex() + "?mode=memory&cache=shared"}
+}
+
+func TestSqliteRepositoryConformance(t *testing.T) {
+	runConformance(t, func(t *testing.T) repository.PlanetRepositoryInterface {
+		return newSqlRepository(t, newSqliteConfig())
+	})
+}
+
+func TestSqlRepositoryShouldApplyMigrationsOnce(t *testing.T) {
+	ctx := context.Background()
+	sqliteConfig := newSqliteConfig()
+
+	db, err := sql.Open(sqliteConfig.Driver, sqliteConfig.DSN)
+	require.NoError(t, err)
+	defer db.Close()
+
+	first := newSqlRepository(t, sqliteConfig)
+	saved, err := first.Save(ctx, &repository.Planet{Name: "Tatooine"})
+	require.NoError(t, err)
+
+	second := newSqlRepository(t, sqliteConfig)
+	found, err := second.FindById(ctx, saved.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "Tatooine", found.Name)
+
+	var migrations int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&migrations))
+	assert.Equal(t, 17, migrations)
+}
+
+func TestSqlRepositoryShouldFailWhenMigrationsFail(t *testing.T) {
+	repo, err := repository.NewSqlSession(config.SqlConfig{Driver: "sqlite3", DSN: "file:" + t.TempDir() + "/missing/planets.db"})
+
+	assert.Error(t, err)
+	assert.Nil(t, repo)
+}
+
+func TestSqlRepositoryShouldEscapeLikeWildcards(t *testing.T) {
+	ctx := context.Background()
+	repo := newSqlRepository(t, newSqliteConfig())
+
+	_, _ = repo.Save(ctx, &repository.Planet{Name: "Hoth"})
+	_, _ = repo.Save(ctx, &repository.Planet{Name: "100% Hoth_"})
+
+	planets, err := repo.FindAll(ctx, repository.Filter{NameContains: "%"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"100% Hoth_"}, names(*planets))
+
+	planets, err = repo.FindAll(ctx, repository.Filter{NamePrefix: "_"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, names(*planets))
+}